@@ -16,12 +16,22 @@ through the provided read methods or is on the db.  All reads from the api go
 to the database itself and bypass the funnel so that reads and writes don't
 have to compete for access.  When an update is called for an Node that is in
 the funnel that update will be applied to that copy of the Node in the funnel.
+
+Deletes go through the funnel as well.  A deleted Node is replaced in the
+funnel by a tombstone, which turns into a delete on the next write and stops
+any later update from putting the Node back.
+
+If you do need to read your own writes, open the DB with ReadYourWrites set.
+Reads will then lay whatever is waiting in the funnel over what they find on
+the db (including nodes that aren't on the db yet), at the cost of competing
+with updates for the funnel.
 */
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
 	"github.com/syndtr/goleveldb/leveldb"
-	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/syndtr/goleveldb/leveldb/opt"
 	"sync"
 	"time"
 	"github.com/AVickory/levTree/keyChain"
@@ -31,22 +41,67 @@ import (
 //instead of blocking. The funnel is a blocking update cache so that writes can
 //be batch written to the db.  This allows for less total time spent blocking
 //reads during writing and
-var funnel struct {
+type funnel struct {
+	//held while nodes are put into or cleared out of the funnel, so that a
+	//flush can't lose anything that's put in while it's writing.  Updates only
+	//hold it long enough to put their nodes in; the nodes themselves are
+	//locked by the db's keyLocks.
 	mutex sync.Mutex
+
+	//guards the nodes and deleted maps, so that reads can look into the
+	//funnel without waiting for open updates to close.  Anything that
+	//modifies them must hold both locks.
+	nodesMutex sync.RWMutex
 	nodes map[string]Node
+
+	//tombstones for nodes that have been deleted but are still on the db.  A
+	//key is never in both nodes and deleted.
+	deleted map[string]Node
+}
+
+//puts n in the funnel.  The caller must hold the funnel's mutex.
+func (f *funnel) put(n Node) {
+	f.nodesMutex.Lock()
+	delete(f.deleted, n.KeyString())
+	f.nodes[n.KeyString()] = n
+	f.nodesMutex.Unlock()
+}
+
+//puts a tombstone for n in the funnel, replacing any pending update to it.
+//The caller must hold the funnel's mutex.
+func (f *funnel) tombstone(n Node) {
+	f.nodesMutex.Lock()
+	delete(f.nodes, n.KeyString())
+	f.deleted[n.KeyString()] = n
+	f.nodesMutex.Unlock()
 }
 
-//time between write batches.  Will make this settable later
-var waitBetweenWrites time.Duration = 1 * time.Second
+//empties the funnel.  The caller must hold the funnel's mutex.
+func (f *funnel) reset() {
+	f.nodesMutex.Lock()
+	f.nodes = make(map[string]Node)
+	f.deleted = make(map[string]Node)
+	f.nodesMutex.Unlock()
+}
+
+func (f *funnel) isEmpty() bool {
+	return len(f.nodes) == 0 && len(f.deleted) == 0
+}
+
+//returns whether key has a tombstone in the funnel.  The caller must hold at
+//least a read lock on nodesMutex.
+func (f *funnel) isDeleted(key string) bool {
+	_, isDeleted := f.deleted[key]
+	return isDeleted
+}
 
-//string of the filepath to leveldb
-var dbPath string
+//default time between write batches.
+const defaultWaitBetweenWrites time.Duration = 1 * time.Second
 
-//initializes the funnel and registers package types with gob.  Any named types contained in a
+//registers package types with gob.  Any named types contained in a
 //Record's data property must also be registered before serializing or
 //deserializing to or from the db.
 func init() {
-	funnel.nodes = make(map[string]Node)
 	gob.Register(keyChain.KeyChain{})
 	gob.Register(keyChain.Id{})
 	gob.Register(keyChain.Loc{})
@@ -54,24 +109,34 @@ func init() {
 }
 
 //starts the funnel.  This will periodically write all entries from the funnel
-//to disk and then clear the entries from the funnel.
-func startFunnel() {
+//to disk and then clear the entries from the funnel.  It runs until the stop
+//channel is closed and closes the stopped channel on the way out, so that
+//Close can wait for any write in progress to finish.
+func (db *DB) startFunnel() {
+	ticker := time.NewTicker(db.waitBetweenWrites)
+	defer ticker.Stop()
+	defer close(db.stopped)
+
 	for {
-		time.Sleep(waitBetweenWrites)
-		err := clearFunnel()
-		if err != nil {
-			//I need to check for db failure here and figure out how to
-			//handle it gracefully.
-			fmt.Println("Error clearing funnel:", err)
+		select {
+		case <-db.stop:
+			return
+		case <-ticker.C:
+			err := db.clearFunnel()
+			if err != nil {
+				//failed writes stay in the funnel, so they'll be retried
+				//on the next tick (or by Close).
+				fmt.Println("Error clearing funnel:", err)
+			}
 		}
 	}
 }
 
 //Takes all entries from the funnel and puts then in a batch object.
-func writeFunnelToBatch() *leveldb.Batch {
+func (db *DB) writeFunnelToBatch() *leveldb.Batch {
 	batch := new(leveldb.Batch)
 
-	for _, n := range funnel.nodes {
+	for _, n := range db.funnel.nodes {
 		nSerial, err := n.serialize()
 
 		if err != nil {
@@ -83,132 +148,151 @@ func writeFunnelToBatch() *leveldb.Batch {
 		}
 	}
 
-	funnel.nodes = make(map[string]Node)
+	for _, n := range db.funnel.deleted {
+		batch.Delete(n.Key())
+	}
 
 	return batch
 }
 
-func writeBatch(batch *leveldb.Batch) error {
-	db, err := leveldb.OpenFile(dbPath, nil)
-	defer db.Close()
+func (db *DB) writeBatch(batch *leveldb.Batch) error {
+	err := db.ldb.Write(batch, nil)
 
 	if err != nil {
-		fmt.Println("error opening db: ", err)
+		fmt.Println("error writing batch", err)
 		return err
 	}
 
-	err = db.Write(batch, nil)
+	return nil
+} 
 
-	if err != nil {
-		fmt.Println("error writing batch", err)
-		return err
+//the options the funnel is written with.  A db with a write ahead log truncates
+//it straight after, so the write has to have reached the disk by then or the
+//updates the log was keeping could be lost.
+func (db *DB) funnelWriteOptions() *opt.WriteOptions {
+	if db.wal != nil {
+		return &opt.WriteOptions{Sync: true}
 	}
 
 	return nil
-} 
+}
 
 //blocks funnel access, Writes all entries in the funnel to disk and then
-//resets the funnel.
-func clearFunnel() error {
-	funnel.mutex.Lock()
-	defer funnel.mutex.Unlock()
+//resets the funnel.  If the write fails the funnel is left as it was.
+func (db *DB) clearFunnel() error {
+	db.funnel.mutex.Lock()
+	defer db.funnel.mutex.Unlock()
 
-	if len(funnel.nodes) != 0 {
+	if !db.funnel.isEmpty() {
+		return db.writeFunnelWith(nil)
+	}
 
-		batch := writeFunnelToBatch()
+	return nil
+}
 
-		// err := transactionalBatch(batch)
+//writes everything in the funnel and then everything in batch to the db in a
+//single write, and empties the funnel.  batch comes after the funnel, so it
+//wins over anything in the funnel for the same key.  If the write fails the
+//funnel is left as it was.  Lock the funnel outside of this function.
+func (db *DB) writeFunnelWith(batch *leveldb.Batch) error {
+	full := db.writeFunnelToBatch()
 
-		err := writeBatch(batch)
+	if batch != nil {
+		err := batch.Replay(full)
 
 		if err != nil {
-			fmt.Println("error clearing funnel ", err)
+			fmt.Println("error adding to funnel's batch ", err)
 			return err
 		}
-
 	}
 
-	return nil
-}
-
-//At somepoint the return from here and the funnel will be put into a trie, but
-//for now I'm sticking with the basics.  Also this function is too long.
-func getNodesFromBucket(bucket Keyor) ([]Node, error) { 
-	db, err := leveldb.OpenFile(dbPath, nil)
-	defer db.Close()
+	err := db.ldb.Write(full, db.funnelWriteOptions())
 
 	if err != nil {
-		fmt.Println("Error opening file: ", err)
-		return nil, err
+		fmt.Println("error clearing funnel ", err)
+		return err
 	}
 
-	nodes := make([]Node, 0, 10)
-
-	iter := db.NewIterator(util.BytesPrefix(bucket.Key()), nil)
+	db.funnel.reset()
 
-	for iter.Next() {
-		// nodes = append(nodes, Node{})
-
-		nSerial := iter.Value()
-		
-		n := new(Node)
-		err := n.deserialize(nSerial)
+	if db.wal != nil {
+		err = db.wal.truncate()
 
 		if err != nil {
-			fmt.Println("error deserializing record", 
-				"\n\tkey: ", iter.Key(),
-				"\n\tpayload: ", nSerial,
-				"\n\terror: ", err) //should this be returned?
-		} else {
-			nodes = append(nodes, *n) //this is super inefficient.  I'll fix the resizing behavior later.
+			fmt.Println("error truncating write ahead log ", err)
+			return err
 		}
 	}
 
-	iter.Release()
+	return nil
+}
+
+//At somepoint the return from here and the funnel will be put into a trie, but
+//for now I'm sticking with the basics.
+//If the db reads its own writes then the funnel is laid over the db as they
+//both were when the scan started, so that a flush can't land between reading
+//the db and reading the funnel.
+func (db *DB) getNodesFromBucket(bucket Keyor) ([]Node, error) { 
+	return db.scanBucket(bucket, db.readYourWrites)
+}
 
-	err = iter.Error()
+//gets the nodes in bucket, laying the funnel over them if overlay is set.
+//Deletes and updates need to see the funnel whether or not the db reads its own
+//writes.
+func (db *DB) scanBucket(bucket Keyor, overlay bool) ([]Node, error) {
+	nodes, err := collectNodes(db.newBucketIterator(bucket, overlay))
 
 	if err != nil {
 		fmt.Println("error in iterator: ", err)
 		return nodes, err
 	}
 
-	return nodes, err
+	return nodes, nil
 }
 
-func getNodesFromBucketUpdateable(bucket Keyor) ([]Node, error) {
-	dbNodes, err := getNodesFromBucket(bucket)
-	if err != nil {
-		fmt.Println("error getting nodes from bucket")
-		return nil, err
-	}
+//gets only the nodes in bucket whose parent is at parentLoc.  Most buckets
+//only hold immediate children anyway, but the root's child bucket (among
+//others) is a prefix of every key below it.  Since every key under an
+//immediate child's key belongs to something deeper, the scan seeks past them
+//instead of reading them, so listing the forests costs one seek per forest
+//rather than a read of the entire db.
+func (db *DB) getImmediateChildren(bucket Keyor, parentLoc keyChain.Loc) ([]Node, error) {
+	nodes, err := collectNodes(db.newChildIterator(bucket, parentLoc))
 
-	for idx, node := range dbNodes {
-		upToDateNode, isInFunnel := funnel.nodes[node.KeyString()]
-		if isInFunnel {
-			dbNodes[idx] = upToDateNode
-		} else {
-			funnel.nodes[node.KeyString()] = node
-		}
+	if err != nil {
+		fmt.Println("error in iterator: ", err)
+		return nodes, err
 	}
 
-	return dbNodes, nil
+	return nodes, nil
 }
 
+// Returned when there is no node at a location (or the node has been deleted).
+var ErrNotFound = leveldb.ErrNotFound
+
 //gets from the db.  Note that this will not necesarily be up to date if the
-//funnle has not cleared updates into the db.
-func getNode(l Keyor) (Node, error) {
+//funnle has not cleared updates into the db, unless the db reads its own
+//writes, in which case the funnel's copy is returned if there is one.
+func (db *DB) getNode(l Keyor) (Node, error) {
 	var n Node
 
-	db, err := leveldb.OpenFile(dbPath, nil)
-	defer db.Close()
+	if db.readYourWrites {
+		db.funnel.nodesMutex.RLock()
+		defer db.funnel.nodesMutex.RUnlock()
 
-	if err != nil {
-		fmt.Println("error opening db", err)
-		return n, nil
+		if db.funnel.isDeleted(l.KeyString()) {
+			return n, ErrNotFound
+		}
+
+		var isInFunnel bool
+		n, isInFunnel = db.funnel.nodes[l.KeyString()]
+
+		if isInFunnel {
+			return n, nil
+		}
 	}
 
-	nSerial, err := db.Get(l.Key(), nil)
+	nSerial, err := db.ldb.Get(l.Key(), nil)
 
 	if err != nil {
 		fmt.Println("Error getting Node from db: ", err, 
@@ -226,56 +310,217 @@ func getNode(l Keyor) (Node, error) {
 	return n, nil
 }
 
-//Lock and unlock funnel outside of this function if used in concurrent context.
-//This allows update functions to behave atomically, without requiring
-//rewriting all of the boilerplate of figuring out whether or not the Node is
-//already in the funnel.  It should not be used outside of this context.
-func getNodeUpdateable(l Keyor) (Node, error) {
-
-	n, isInFunnel := funnel.nodes[l.KeyString()]
+//Gets the most up to date copy of the Node: the funnel's if it has one and the
+//db's otherwise.  Updates need this whether or not the db reads its own writes,
+//since otherwise they'd be applied to stale copies.  Lock the Node outside of
+//this function so that its copy in the funnel can't change underneath the
+//update.
+func (db *DB) getNodeUpdateable(l Keyor) (Node, error) {
+	db.funnel.nodesMutex.RLock()
+	isDeleted := db.funnel.isDeleted(l.KeyString())
+	n, isInFunnel := db.funnel.nodes[l.KeyString()]
+	db.funnel.nodesMutex.RUnlock()
+
+	if isDeleted {
+		fmt.Println("Error getting Node: node has been deleted",
+			"\nnode Key: ", l.Key())
+		return n, ErrNotFound
+	}
 
 	if !isInFunnel {
 		var err error
-		n, err = getNode(l)
+		n, err = db.getNode(l)
 
 		if err != nil {
 			fmt.Println("Error getting Node: ", err)
 			return n, err
 		}
-
-		funnel.nodes[l.KeyString()] = n
 	}
 	return n, nil
 }
 
-func createNode(n Node) error {
-	db, err := leveldb.OpenFile(dbPath, nil)
-	defer db.Close()
+// Returned when making a node where there already is one, which can happen
+// when ids are made from the node's data (see keyChain.ContentHash).
+var ErrExists = errors.New("levTree: there is already a node at that location")
+
+//returns ErrExists if there's a node at l, in the funnel or on the db, and
+//reports whether there's a tombstone for l waiting in the funnel.  Lock the
+//funnel outside of this function.
+func (db *DB) checkFree(l Keyor) (tombstoned bool, err error) {
+	db.funnel.nodesMutex.RLock()
+	tombstoned = db.funnel.isDeleted(l.KeyString())
+	_, isInFunnel := db.funnel.nodes[l.KeyString()]
+	db.funnel.nodesMutex.RUnlock()
+
+	if tombstoned {
+		return true, nil
+	}
+
+	if isInFunnel {
+		return false, ErrExists
+	}
+
+	_, err = db.ldb.Get(l.Key(), nil)
+
+	if err == nil {
+		return false, ErrExists
+	} else if err != ErrNotFound {
+		fmt.Println("error checking for node: ", err)
+		return false, err
+	}
+
+	return false, nil
+}
+
+//returns ErrNotFound unless the parent of n is there to make it under.  Lock
+//the parent outside of this function, so that it can't be moved or deleted
+//until n's been made.
+func (db *DB) checkParent(n Node) error {
+	if n.GetParentLoc().Equal(rootNode.GetLoc()) {
+		return nil
+	}
+
+	key := n.GetParentLoc().KeyString()
+
+	db.funnel.nodesMutex.RLock()
+	isDeleted := db.funnel.isDeleted(key)
+	_, isInFunnel := db.funnel.nodes[key]
+	db.funnel.nodesMutex.RUnlock()
+
+	if isDeleted {
+		return ErrNotFound
+	}
+
+	if isInFunnel {
+		return nil
+	}
+
+	_, err := db.ldb.Get(n.ParentKey(), nil)
+
+	return err
+}
+
+//the keys to lock while making n: its own, so that nothing else can be made
+//there, and its parent's, so that the parent can't be moved or deleted out
+//from under it.
+func createLocks(n Node) []string {
+	return []string{n.KeyString(), n.GetParentLoc().KeyString()}
+}
+
+//writes batch, which makes news, unless one of them is already there or the
+//parent of the first is gone.  The rest have to be descendants of the first.
+//If any of them were deleted and their tombstones are still in the funnel
+//batch is written along with the funnel, so the tombstones don't delete them
+//on the next write.  Lock createLocks(news[0]) and the keys of the rest outside
+//of this function.
+func (db *DB) createWith(batch *leveldb.Batch, news ...Node) error {
+	db.funnel.mutex.Lock()
+	defer db.funnel.mutex.Unlock()
+
+	err := db.checkParent(news[0])
 
 	if err != nil {
-		fmt.Println("error opening db: ", err)
+		fmt.Println("error getting new node's parent: ", err)
 		return err
 	}
 
-	nSerial, err := n.serialize()
+	tombstoned := false
+
+	for _, n := range news {
+		t, err := db.checkFree(n)
+
+		if err != nil {
+			fmt.Println("error making node: ", err)
+			return err
+		}
+
+		tombstoned = tombstoned || t
+	}
+
+	if tombstoned {
+		return db.writeFunnelWith(batch)
+	}
+
+	return db.writeBatch(batch)
+}
+
+//writes a new node, unless there's already a node where it goes or its parent
+//is gone.
+func (db *DB) createNode(n Node) error {
+	db.locks.lock(createLocks(n)...)
+	defer db.locks.unlock(createLocks(n)...)
+
+	batch := new(leveldb.Batch)
+
+	err := putNodes(batch, n)
 
 	if err != nil {
 		fmt.Println("error putting node: ", err)
 		return err
 	}
 
-	err = db.Put(n.Key(), nSerial, nil)
+	return db.createWith(batch, n)
+}
+
+//adds puts for nodes to batch.
+func putNodes(batch *leveldb.Batch, nodes ...Node) error {
+	for _, n := range nodes {
+		nSerial, err := n.serialize()
 
-	if err != nil {
-		fmt.Println("error writing node to db: ", err)
-		return err
+		if err != nil {
+			fmt.Println("error putting node: ", err)
+			return err
+		}
+
+		batch.Put(n.Key(), nSerial)
 	}
 
 	return nil
 }
 
-func bulkPut(nodes ...Node) {
-	for _, v := range nodes {
-		funnel.nodes[v.KeyString()] = v
+//logs nodes to the write ahead log (if the db keeps one) and then puts them in
+//the funnel.  Nothing goes into the funnel if the log can't be written.  Lock
+//the funnel outside of this function.
+func (db *DB) bulkPut(nodes ...Node) error {
+	return db.bulkWrite(nodes, nil)
+}
+
+//logs and puts tombstones for nodes in the funnel.  Lock the funnel outside of
+//this function.
+func (db *DB) bulkDelete(nodes ...Node) error {
+	return db.bulkWrite(nil, nodes)
+}
+
+//logs puts and deletes as a single entry in the write ahead log (if the db
+//keeps one) and then puts them in the funnel, so that they're replayed all
+//or nothing.  Lock the funnel outside of this function.
+func (db *DB) bulkWrite(puts []Node, deletes []Node) error {
+	if db.wal != nil {
+		entries := make([]walEntry, 0, len(puts) + len(deletes))
+
+		for _, n := range puts {
+			entries = append(entries, walEntry{node: n})
+		}
+
+		for _, n := range deletes {
+			entries = append(entries, walEntry{node: n, deleted: true})
+		}
+
+		err := db.wal.append(entries...)
+
+		if err != nil {
+			fmt.Println("error logging nodes: ", err)
+			return err
+		}
+	}
+
+	for _, v := range puts {
+		db.funnel.put(v)
 	}
+
+	for _, v := range deletes {
+		db.funnel.tombstone(v)
+	}
+
+	return nil
 }
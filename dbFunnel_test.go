@@ -2,15 +2,14 @@ package levTree
 
 import (
 	"fmt"
-	"github.com/syndtr/goleveldb/leveldb"
 	"os"
 	"testing"
 	"time"
 	"bytes"
 )
 
-func clearDb() error {
-	err := os.RemoveAll(dbPath)
+func clearDb(path string) error {
+	err := os.RemoveAll(path)
 
 	if err != nil {
 		fmt.Println("error clearing DB files")
@@ -20,40 +19,39 @@ func clearDb() error {
 	return nil
 }
 
-func initForSynchronousTests() error {
-	dbPath = "./data/db"
-	waitBetweenWrites = 10 * time.Millisecond
+//every test gets its own database so that tests can run in parallel.
+func initForSynchronousTests(t *testing.T) (*DB, error) {
+	path := "./data/" + t.Name()
 
-	err := clearDb()
+	err := clearDb(path)
 
 	if err != nil {
 		fmt.Println("error clearing db: ", err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	db, err := Open(path, Options{WriteInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		fmt.Println("error opening db: ", err)
+		return nil, err
+	}
+
+	return db, nil
 }
 
 //I say sync, but what I actually mean is that this should not be used
 //concurrently in general. (technically it ought to be fine for create
 //operations, but you could get some wackyness going on with concurrent
 //updates)
-func syncPut(n Node) error {
-	db, err := leveldb.OpenFile(dbPath, nil)
-	defer db.Close()
-
-	if err != nil {
-		fmt.Println("error opening database", err)
-		return err
-	}
-
+func syncPut(db *DB, n Node) error {
 	nSerial, err := n.serialize()
 	if err != nil {
 		fmt.Println("error serializing node: ", err)
 		return err
 	}
 
-	err = db.Put(n.Key(), nSerial, nil)
+	err = db.ldb.Put(n.Key(), nSerial, nil)
 
 	if err != nil {
 		fmt.Println("error putting root into db", err)
@@ -64,7 +62,7 @@ func syncPut(n Node) error {
 }
 
 func TestFunnel(t *testing.T) {
-	err := initForSynchronousTests()
+	db, err := initForSynchronousTests(t)
 
 	if err != nil {
 		t.Error("error initializing db", err)
@@ -76,7 +74,7 @@ func TestFunnel(t *testing.T) {
 		t.Error("error making node")
 	}
 
-	err = createNode(n1)
+	err = db.createNode(n1)
 
 	if err != nil {
 		t.Error("error entering node into db")
@@ -84,7 +82,7 @@ func TestFunnel(t *testing.T) {
 
 	n1.Data = []byte{2}
 
-	n2, err := getNodeUpdateable(n1)
+	n2, err := db.getNodeUpdateable(n1)
 
 	if err != nil {
 		t.Error("error putting node into funnel")
@@ -96,7 +94,7 @@ func TestFunnel(t *testing.T) {
 
 	n2.Data = n1.Data
 
-	if bytes.Equal(funnel.nodes[n2.KeyString()].Data, n2.Data) {
+	if bytes.Equal(db.funnel.nodes[n2.KeyString()].Data, n2.Data) {
 		//at some point I might have the funnel use pointers, but for the time
 		//being It's important to some of the logic that changes to the node
 		//returned by getNodeIntoFunnel not change the copy of the node that is
@@ -104,15 +102,15 @@ func TestFunnel(t *testing.T) {
 		t.Error("Changes to node should not change the copy in the funnel")
 	}
 
-	funnel.nodes[n2.KeyString()] = n2
+	db.funnel.nodes[n2.KeyString()] = n2
 
-	err = clearFunnel()
+	err = db.clearFunnel()
 
 	if err != nil {
 		t.Error("error clearing funnel", err)
 	}
 
-	n3, err := getNode(n2)
+	n3, err := db.getNode(n2)
 
 	if err != nil {
 		t.Error("error getting saved node: ", err)
@@ -125,7 +123,7 @@ func TestFunnel(t *testing.T) {
 	}
 }
 
-func setUpChildSearch (t *testing.T) (map[string]Node) {
+func setUpChildSearch (t *testing.T, db *DB) (map[string]Node) {
 	nodes := make(map[string]Node)
 	var err error
 
@@ -179,14 +177,19 @@ func setUpChildSearch (t *testing.T) (map[string]Node) {
 
 	nodes["branch111"], err = makeBranch(nodes["branch11"], []byte{9})
 
-	for name, val := range nodes {
+	//parents have to be made before their children.
+	names := []string{"forest", "tree1", "tree2", "tree11", "branch1", "branch2",
+		"branch11", "branch12", "branch111"}
+
+	for _, name := range names {
+		val := nodes[name]
 		// fmt.Println(name)
-		err = createNode(val)
+		err = db.createNode(val)
 		if err != nil {
 			t.Error("error saving node with name: ", name)
 		}
 
-		_, err = getNode(val.GetLoc())
+		_, err = db.getNode(val.GetLoc())
 		if err != nil {
 			t.Error(name, " didn't make it to the db")
 		}
@@ -217,8 +220,8 @@ func MapValsNotInSlice (m map[string]Node, s []Node) map[string]Node {
 	return absentVals
 }
 
-func checkNumChildrenAbsentFromSearch(t *testing.T, nodes map[string]Node, n Node, expected int) bool {
-	children, err := getNodesFromBucket(n.GetChildBucket())
+func checkNumChildrenAbsentFromSearch(t *testing.T, db *DB, nodes map[string]Node, n Node, expected int) bool {
+	children, err := db.getNodesFromBucket(n.GetChildBucket())
 
 	if err != nil {
 		t.Error("error getting node's children", err)
@@ -242,85 +245,52 @@ func printLocs(nodes []Node) {
 }
 
 func TestChildSearch (t *testing.T) {
-	err := initForSynchronousTests()
+	db, err := initForSynchronousTests(t)
 	if err != nil {
 		t.Error("error initializing db")
 	}
-	nodes := setUpChildSearch(t)
+	nodes := setUpChildSearch(t, db)
 
 	// fmt.Println("rootNode: ")
 	// t.Error("rootNode: ")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, rootNode, len(nodes)) // all nodes plus
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, rootNode, 1) // just the forest
 	// fmt.Println("\n\nforest:")
 	// t.Error("forest:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["forest"], 4) //all but itself
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["forest"], 4) //all but itself
 
 	// fmt.Println("\n\ntree1:")
 	// t.Error("tree1:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["tree1"], 1) //tree1 and tree11
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["tree1"], 1) //tree1 and tree11
 
 	// fmt.Println("\n\ntree2:")
 	// t.Error("tree2:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["tree2"], 0) //tree2
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["tree2"], 0) //tree2
 
 	// fmt.Println("\n\ntree11:")
 	// t.Error("tree11:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["tree11"], 0) //tree11
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["tree11"], 0) //tree11
 
 	// fmt.Println("\n\nbranch2:")
 	// t.Error("branch2:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["branch2"], 0)
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["branch2"], 0)
 
 	// fmt.Println("\n\nbranch1:")
 	// t.Error("branch1:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["branch1"], 2) //branch11 and branch12
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["branch1"], 2) //branch11 and branch12
 
 	// fmt.Println("\n\nbranch11:")
 	// t.Error("branch11:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["branch11"], 1) //branch111
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["branch11"], 1) //branch111
 
 	// fmt.Println("\n\nbranch12:")
 	// t.Error("branch12:")
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["branch12"], 0)
-
-	_ = checkNumChildrenAbsentFromSearch(t, nodes, nodes["branch111"], 0)
-
-	forestChildren, err := getNodesFromBucketUpdateable(nodes["forest"].GetChildBucket())
-
-	if err != nil {
-		t.Error("error getting updateable children", err)
-	}
-
-	for _, v := range forestChildren {
-		child := v
-		child.Data = append(child.Data, child.Data[0]+1)
-		if bytes.Equal(funnel.nodes[child.KeyString()].Data, child.Data) {
-			t.Error("funnel's data should not have changed when updateable node changed")
-		}
-		funnel.nodes[child.KeyString()] = child
-	}
-
-	err = clearFunnel()
-
-	if err != nil {
-		t.Error("error clearing funnel")
-	}
-
-	forestChildren2, err := getNodesFromBucket(nodes["forest"].GetChildBucket())
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["branch12"], 0)
 
-	for i, v := range forestChildren2 {
-		forestChild := forestChildren[i].Data
-		if !(v.Data[0] == forestChild[0] && len(v.Data) == 2) {
-			t.Error("update didn't work correctly", 
-				"\n original: ", forestChildren[i].Data,
-				"\n updated", v.Data)
-		}
-	}
-	
+	_ = checkNumChildrenAbsentFromSearch(t, db, nodes, nodes["branch111"], 0)
 }
 
 func TestBulkPut (t *testing.T) {
-	err := initForSynchronousTests()
+	db, err := initForSynchronousTests(t)
 
 	if err != nil {
 		t.Error("error initializing db: ", err)
@@ -346,15 +316,15 @@ func TestBulkPut (t *testing.T) {
 		t.Error("error making forest")
 	}
 
-	bulkPut(nodes...)
+	db.bulkPut(nodes...)
 
-	err = clearFunnel()
+	err = db.clearFunnel()
 
 	if err != nil {
 		t.Error("error clearing funnel", err)
 	}
 
-	savedNodes, err := getNodesFromBucket(nodes[0].GetChildBucket())
+	savedNodes, err := db.getNodesFromBucket(nodes[0].GetChildBucket())
 
 	for i, v := range savedNodes {
 		if !bytes.Equal(v.Data, []byte{byte(i+1)}) {
@@ -365,4 +335,119 @@ func TestBulkPut (t *testing.T) {
 	}
 
 
-}
\ No newline at end of file
+}
+func TestCloseFlushesFunnel (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	n, err := makeForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	n.Data = []byte{1}
+
+	db.bulkPut(n)
+
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	db, err = Open(db.path, Options{})
+
+	if err != nil {
+		t.Error("error reopening db: ", err)
+	}
+
+	defer db.Close()
+
+	saved, err := db.getNode(n)
+
+	if err != nil {
+		t.Error("error getting node after reopening: ", err)
+	}
+
+	if !bytes.Equal(saved.Data, n.Data) {
+		t.Error("close did not flush the funnel",
+			"\nexpected: ", n.Data,
+			"\nfound: ", saved.Data)
+	}
+}
+
+func TestConcurrentReads (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	nodes := setUpChildSearch(t, db)
+
+	errs := make(chan error, len(nodes))
+
+	for _, v := range nodes {
+		go func(n Node) {
+			_, err := db.getNode(n)
+			errs <- err
+		}(v)
+	}
+
+	for range nodes {
+		err := <-errs
+		if err != nil {
+			t.Error("concurrent read failed: ", err)
+		}
+	}
+}
+
+func TestFlush (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	n, err := makeForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	db.bulkPut(n)
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing funnel: ", err)
+	}
+
+	if len(db.funnel.nodes) != 0 {
+		t.Error("flush should have emptied the funnel, but it holds: ", len(db.funnel.nodes))
+	}
+
+	_, err = db.getNode(n)
+
+	if err != nil {
+		t.Error("flushed node was not on the db: ", err)
+	}
+
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	select {
+	case <-db.stopped:
+	default:
+		t.Error("close did not stop the funnel")
+	}
+}
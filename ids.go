@@ -0,0 +1,154 @@
+package levTree
+
+/*
+The ids module decides how the ids of new nodes are made.  Every DB has a
+generator that's used by default (random UUIDs unless it's opened with another),
+and any forest can be given its own, which is then used for everything made
+inside of it.  Forests' own generators only last as long as the DB handle, so
+they have to be set again each time the db is opened.  Since siblings come off
+of the db in the order of their ids, this is also how to choose the order
+children are read in; see keyChain/generators.go for the generators that come
+with it.
+
+A Counter numbers the nodes it makes 1, 2, 3... in the order they're made, and
+keeps its count on the db in the meta keyspace, so that it carries on where it
+left off when the db is opened again.  The count is written before the id is
+handed out, so a number is never given out twice even if the process dies.
+
+Ordered children (see ordered.go) get ids from their positions instead.
+*/
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+	"github.com/AVickory/levTree/keyChain"
+)
+
+//the start of every counter's key.
+var counterPrefix = []byte{metaPrefix, 'c'}
+
+type idGenerators struct {
+	mutex sync.RWMutex
+	defaultGenerator keyChain.IdGenerator
+
+	//generators for particular forests, by the forest's id's key.
+	forests map[string]keyChain.IdGenerator
+
+	//the counters that have been made, by name.
+	counters map[string]*Counter
+}
+
+// Makes gen the generator for the ids of everything made in the forest at l
+// from now on.  A nil gen goes back to the DB's generator.
+func (db *DB) SetForestIdGenerator(l locateable, gen keyChain.IdGenerator) {
+	key := string(l.GetLoc().GetId().Key())
+
+	db.ids.mutex.Lock()
+	defer db.ids.mutex.Unlock()
+
+	if gen == nil {
+		delete(db.ids.forests, key)
+	} else {
+		db.ids.forests[key] = gen
+	}
+}
+
+//gets the generator for ids in the same forest as kc.
+func (db *DB) idGeneratorFor(kc keyChain.KeyChain) keyChain.IdGenerator {
+	db.ids.mutex.RLock()
+	defer db.ids.mutex.RUnlock()
+
+	forestId, inForest := kc.ForestId()
+
+	if inForest {
+		gen, isSet := db.ids.forests[string(forestId.Key())]
+
+		if isSet {
+			return gen
+		}
+	}
+
+	return db.ids.defaultGenerator
+}
+
+//gives n a new identifier from the generator for its forest, in place of the
+//one it was made with.
+func (db *DB) assignId(n *Node) error {
+	identifier, err := db.idGeneratorFor(n.KeyChain).NewIdentifier(n.Data)
+
+	if err != nil {
+		fmt.Println("error generating id: ", err)
+		return err
+	}
+
+	if len(identifier) == 0 {
+		fmt.Println("error generating id: ", keyChain.ErrEmptyIdentifier)
+		return keyChain.ErrEmptyIdentifier
+	}
+
+	n.Id.Identifier = identifier
+
+	return nil
+}
+
+// A Counter is an IdGenerator that gives out 8 byte ids counting up from 1, and
+// keeps its count on the db.  Get it with NewCounter.
+type Counter struct {
+	db *DB
+	key []byte
+
+	mutex sync.Mutex
+	count uint64
+}
+
+// Gets the counter called name, which carries on from wherever it was when the
+// db was last closed.  Every call with the same name gets the same counter, so
+// it never gives out the same number twice.
+func (db *DB) NewCounter(name string) (*Counter, error) {
+	db.ids.mutex.Lock()
+	defer db.ids.mutex.Unlock()
+
+	c, found := db.ids.counters[name]
+
+	if found {
+		return c, nil
+	}
+
+	c = &Counter{
+		db: db,
+		key: append(append([]byte{}, counterPrefix...), name...),
+	}
+
+	count, err := db.ldb.Get(c.key, nil)
+
+	if err == nil {
+		c.count = binary.BigEndian.Uint64(count)
+	} else if err != ErrNotFound {
+		fmt.Println("error reading counter: ", err)
+		return nil, err
+	}
+
+	db.ids.counters[name] = c
+
+	return c, nil
+}
+
+func (c *Counter) NewIdentifier(data []byte) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	identifier := make([]byte, 8)
+	binary.BigEndian.PutUint64(identifier, c.count + 1)
+
+	err := c.db.ldb.Put(c.key, identifier, nil)
+
+	if err != nil {
+		fmt.Println("error saving counter: ", err)
+		return nil, err
+	}
+
+	c.count++
+
+	return identifier, nil
+}
@@ -0,0 +1,245 @@
+package levTree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+	"github.com/AVickory/levTree/keyChain"
+)
+
+func openWithGenerator (t *testing.T, path string, gen keyChain.IdGenerator) *DB {
+	db, err := Open(path, Options{WriteInterval: 10 * time.Millisecond, IdGenerator: gen})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	return db
+}
+
+func TestIdGenerators (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	db := openWithGenerator(t, path, keyChain.NewUUIDv7())
+
+	f := forestTest(t, db, []byte{0})
+
+	//time ordered ids come back in the order they were made.
+	for i := 1; i <= 20; i++ {
+		_ = branchTest(t, db, f, []byte{byte(i)})
+	}
+
+	children, err := db.GetChildren(f)
+
+	if err != nil {
+		t.Error("error getting children: ", err)
+	}
+
+	rangeSearchTest(t, f, children, 20)
+
+	for i, c := range children {
+		if !bytes.Equal(c.Data, []byte{byte(i + 1)}) {
+			t.Error("children were not in the order they were made: ", c.Data)
+		}
+	}
+
+	//a forest with content hashes gets the same id for the same data.
+	hashed := forestTest(t, db, []byte{1})
+
+	db.SetForestIdGenerator(hashed, keyChain.ContentHash{})
+
+	h0 := branchTest(t, db, hashed, []byte{2})
+
+	_, err = db.NewBranch(hashed, []byte{2})
+
+	if err != ErrExists {
+		t.Error("the same data should get the same id in a content hashed forest, but returned: ", err)
+	}
+
+	//trees in the forest use it too.
+	ht := treeTest(t, db, hashed, []byte{3})
+
+	h2 := branchTest(t, db, ht, []byte{2})
+
+	if !bytes.Equal(h2.Id.Identifier, h0.Id.Identifier) {
+		t.Error("the forest's generator was not used inside of its trees")
+	}
+
+	//but other forests don't.
+	b0 := branchTest(t, db, f, []byte{2})
+
+	if bytes.Equal(b0.Id.Identifier, h0.Id.Identifier) {
+		t.Error("another forest used the content hashed forest's generator")
+	}
+
+	//counted ids carry on where they left off after the db is reopened.
+	counted := forestTest(t, db, []byte{4})
+
+	c, err := db.NewCounter("counted")
+
+	if err != nil {
+		t.Error("error making counter: ", err)
+	}
+
+	//the same name gets the same counter.
+	again, err := db.NewCounter("counted")
+
+	if err != nil || again != c {
+		t.Error("a second counter was made with the same name: ", err)
+	}
+
+	db.SetForestIdGenerator(counted, c)
+
+	for i := uint64(1); i <= 3; i++ {
+		b := branchTest(t, db, counted, []byte{5})
+
+		if binary.BigEndian.Uint64(b.Id.Identifier) != i {
+			t.Error("counter gave the wrong id: ", b.Id.Identifier)
+		}
+	}
+
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	db = openWithGenerator(t, path, nil)
+
+	defer db.Close()
+
+	c, err = db.NewCounter("counted")
+
+	if err != nil {
+		t.Error("error making counter: ", err)
+	}
+
+	db.SetForestIdGenerator(counted, c)
+
+	b := branchTest(t, db, counted, []byte{5})
+
+	if binary.BigEndian.Uint64(b.Id.Identifier) != 4 {
+		t.Error("counter did not carry on after reopening: ", b.Id.Identifier)
+	}
+
+	//the counter isn't mistaken for a node.
+	getForestsTest(t, db, 3)
+
+	//nil goes back to the db's generator.
+	db.SetForestIdGenerator(counted, nil)
+
+	b = branchTest(t, db, counted, []byte{5})
+
+	if len(b.Id.Identifier) != 16 {
+		t.Error("forest kept its generator after it was removed")
+	}
+}
+
+func TestContentHashExists (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	//nothing is written until it's flushed.
+	db, err := Open(path, Options{WriteInterval: time.Hour, IdGenerator: keyChain.ContentHash{}})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	defer db.Close()
+
+	f, err := db.NewForest([]byte{0})
+
+	if err != nil {
+		t.Fatal("error making forest: ", err)
+	}
+
+	b, err := db.NewBranch(f, []byte{1})
+
+	if err != nil {
+		t.Fatal("error making branch: ", err)
+	}
+
+	err = db.Update(func(tx *Tx) error {
+		n, err := tx.Get(b)
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Put(n)
+	}, b)
+
+	if err != nil {
+		t.Error("error updating branch: ", err)
+	}
+
+	//a sibling with the same data doesn't replace it, in the funnel or on
+	//the db.
+	for _, flush := range []bool{false, true} {
+		if flush {
+			err = db.Flush()
+
+			if err != nil {
+				t.Error("error flushing: ", err)
+			}
+		}
+
+		_, err = db.NewBranch(f, []byte{1})
+
+		if err != ErrExists {
+			t.Error("making a node where there is one should fail, but returned: ", err)
+		}
+	}
+
+	n, err := db.Get(b)
+
+	if err != nil || n.Version != 1 {
+		t.Error("existing node was overwritten: ", n.Version, err)
+	}
+
+	//a node that's made again after it's deleted isn't deleted along with
+	//the old one.
+	err = db.Delete(b)
+
+	if err != nil {
+		t.Error("error deleting branch: ", err)
+	}
+
+	b, err = db.NewBranch(f, []byte{1})
+
+	if err != nil {
+		t.Error("error remaking deleted branch: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	n, err = db.Get(b)
+
+	if err != nil || n.Version != 0 {
+		t.Error("remade node was lost: ", n.Version, err)
+	}
+
+	//and the same goes for copies.
+	_, err = db.CopySubtree(b, f)
+
+	if err != ErrExists {
+		t.Error("copying onto an existing node should fail, but returned: ", err)
+	}
+}
@@ -0,0 +1,340 @@
+package levTree
+
+/*
+The iterator module reads nodes off of the db one at a time instead of reading
+a whole bucket into a slice first, so any number of nodes can be gone through
+with the same memory and the read can be stopped part way through.  Every read
+of more than one node is built on it.
+
+An Iterator reads from a snapshot of the db taken when it's made.  If the db
+reads its own writes, whatever is waiting in the funnel for the iterator's
+bucket is copied when it's made as well, so it sees the funnel and the db as
+they were at the same moment.  Always Release an Iterator when you're done with
+it, or the snapshot is held onto.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"github.com/AVickory/levTree/keyChain"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// An Iterator steps through nodes in key order.  Call Next before reading the
+// first Node, and Release once you're done.
+//	it := db.IterChildren(parent)
+//	defer it.Release()
+//	for it.Next() {
+//		n := it.Node()
+//	}
+//	if it.Err() != nil {
+//		...
+//	}
+type Iterator struct {
+	db *DB
+	iter iterator.Iterator
+
+	//set if only the immediate children of parentLoc are wanted, in which
+	//case anything below a child is skipped over.
+	immediate bool
+	parentLoc keyChain.Loc
+
+	//the key of the last child read from the db.  Everything under it is
+	//sought past on the next read.
+	skipPast []byte
+
+	//if set, the first read from the db seeks here instead of starting at the
+	//beginning of the bucket.
+	start []byte
+
+	//the funnel's copies of nodes in the bucket, in key order, and the keys of
+	//its tombstones.  Both are empty unless the funnel is laid over the db.
+	pending []Node
+	deleted map[string]bool
+
+	//the next node off of the db, if it has been read but not returned yet.
+	dbNode Node
+	hasDbNode bool
+
+	//for iterators over a branch's descendants, the iterators over the
+	//children of each node on the way down from it.  The last one is read
+	//from first.
+	stack []*Iterator
+
+	node Node
+	err error
+	released bool
+}
+
+//makes an iterator over every node in bucket, laying the funnel over them if
+//overlay is set.
+func (db *DB) newBucketIterator(bucket Keyor, overlay bool) *Iterator {
+	return db.newIterator(bucket, nil, false, overlay)
+}
+
+//makes an iterator over the nodes in bucket whose parent is at parentLoc.  See
+//getImmediateChildren.
+func (db *DB) newChildIterator(bucket Keyor, parentLoc keyChain.Loc) *Iterator {
+	return db.newIterator(bucket, parentLoc, true, db.readYourWrites)
+}
+
+func (db *DB) newIterator(bucket Keyor, parentLoc keyChain.Loc, immediate bool, overlay bool) *Iterator {
+	it := &Iterator{
+		db: db,
+		immediate: immediate,
+		parentLoc: parentLoc,
+	}
+
+	prefix := bucket.Key()
+
+	if !overlay {
+		it.iter = db.ldb.NewIterator(util.BytesPrefix(prefix), nil)
+		return it
+	}
+
+	//the funnel is held while the db's snapshot is taken, so that a flush
+	//can't land between the two.
+	db.funnel.nodesMutex.RLock()
+	defer db.funnel.nodesMutex.RUnlock()
+
+	it.iter = db.ldb.NewIterator(util.BytesPrefix(prefix), nil)
+
+	for k, n := range db.funnel.nodes {
+		if strings.HasPrefix(k, string(prefix)) && it.wants(n) {
+			it.pending = append(it.pending, n)
+		}
+	}
+
+	sort.Slice(it.pending, func(i, j int) bool {
+		return it.pending[i].KeyString() < it.pending[j].KeyString()
+	})
+
+	it.deleted = make(map[string]bool, len(db.funnel.deleted))
+
+	for k := range db.funnel.deleted {
+		if strings.HasPrefix(k, string(prefix)) {
+			it.deleted[k] = true
+		}
+	}
+
+	return it
+}
+
+//makes an iterator over a branch's descendants, depth first.  Only the
+//iterators on the way down to the current node are open at once.
+func (db *DB) newDescendantIterator(parent locateable) *Iterator {
+	return &Iterator{
+		db: db,
+		stack: []*Iterator{db.newChildIterator(parent.GetChildBucket(), parent.GetLoc())},
+	}
+}
+
+//starts the iterator at the first node whose key isn't before key, so that a
+//read can pick up where another left off without reading what came before.
+//Must be called before the first call to Next.
+func (it *Iterator) seek(key []byte) {
+	it.start = key
+
+	for len(it.pending) != 0 && bytes.Compare(it.pending[0].Key(), key) < 0 {
+		it.pending = it.pending[1:]
+	}
+}
+
+//whether n belongs in the iterator, ignoring tombstones.
+func (it *Iterator) wants(n Node) bool {
+	return !it.immediate || n.GetParentLoc().Equal(it.parentLoc)
+}
+
+// Moves to the next node.  Returns false once there are no more nodes or an
+// error has happened, check Err to tell which.
+func (it *Iterator) Next() bool {
+	if it.released || it.err != nil {
+		return false
+	}
+
+	if it.stack != nil {
+		return it.nextDescendant()
+	}
+
+	if !it.hasDbNode {
+		it.hasDbNode = it.nextDbNode()
+
+		if it.err != nil {
+			return false
+		}
+	}
+
+	if len(it.pending) != 0 {
+		next := it.pending[0]
+		cmp := 1
+
+		if it.hasDbNode {
+			cmp = bytes.Compare(it.dbNode.Key(), next.Key())
+		}
+
+		if cmp >= 0 {
+			//the funnel's copy replaces the db's.
+			if cmp == 0 {
+				it.hasDbNode = false
+			}
+
+			it.pending = it.pending[1:]
+			it.node = next
+			return true
+		}
+	}
+
+	if !it.hasDbNode {
+		return false
+	}
+
+	it.hasDbNode = false
+	it.node = it.dbNode
+	return true
+}
+
+//reads the next wanted node off of the db into dbNode.  Returns false if there
+//isn't one.
+func (it *Iterator) nextDbNode() bool {
+	for {
+		var ok bool
+
+		if it.start != nil {
+			ok = it.iter.Seek(it.start)
+			it.start = nil
+		} else if it.skipPast != nil {
+			limit := util.BytesPrefix(it.skipPast).Limit
+			it.skipPast = nil
+			ok = limit != nil && it.iter.Seek(limit)
+		} else {
+			ok = it.iter.Next()
+		}
+
+		if !ok {
+			it.err = it.iter.Error()
+
+			if it.err != nil {
+				fmt.Println("error in iterator: ", it.err)
+			}
+
+			return false
+		}
+
+		var n Node
+		err := n.deserialize(it.iter.Value())
+
+		if err != nil {
+			fmt.Println("error deserializing record",
+				"\n\tkey: ", it.iter.Key(),
+				"\n\terror: ", err)
+			continue
+		}
+
+		if !it.wants(n) {
+			continue
+		}
+
+		if it.immediate {
+			//every key under an immediate child's key belongs to
+			//something deeper.
+			it.skipPast = append([]byte{}, it.iter.Key()...)
+		}
+
+		if it.deleted[n.KeyString()] {
+			continue
+		}
+
+		it.dbNode = n
+		return true
+	}
+}
+
+func (it *Iterator) nextDescendant() bool {
+	for len(it.stack) != 0 {
+		top := it.stack[len(it.stack) - 1]
+
+		if top.Next() {
+			it.node = top.Node()
+			it.stack = append(it.stack, it.db.newChildIterator(it.node.GetChildBucket(), it.node.GetLoc()))
+			return true
+		}
+
+		top.Release()
+		it.stack = it.stack[:len(it.stack) - 1]
+
+		if top.Err() != nil {
+			it.err = top.Err()
+			return false
+		}
+	}
+
+	return false
+}
+
+// The node the iterator is at.  Modifications to it cannot be persisted.
+func (it *Iterator) Node() Node {
+	return it.node
+}
+
+// The error that stopped the iterator, if there was one.
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+// Releases the iterator's snapshot of the db.  Safe to call more than once.
+func (it *Iterator) Release() {
+	if it.released {
+		return
+	}
+
+	it.released = true
+
+	if it.iter != nil {
+		it.iter.Release()
+	}
+
+	for _, sub := range it.stack {
+		sub.Release()
+	}
+
+	it.stack = nil
+	it.pending = nil
+}
+
+//reads everything left in it into a slice and releases it.
+func collectNodes(it *Iterator) ([]Node, error) {
+	defer it.Release()
+
+	nodes := make([]Node, 0, 10)
+
+	for it.Next() {
+		nodes = append(nodes, it.Node())
+	}
+
+	return nodes, it.Err()
+}
+
+// Iterates over the calling Node's children.  See GetChildren.
+func (db *DB) IterChildren(parent locateable) *Iterator {
+	return db.newChildIterator(parent.GetChildBucket(), parent.GetLoc())
+}
+
+// Iterates over the calling Node's descendants.  A tree's descendants come in
+// key order off of a single prefix scan, the same as GetDescendants.  A
+// branch's are read depth first, holding only the iterators on the way down to
+// the current node.
+func (db *DB) IterDescendants(parent locateable) *Iterator {
+	if !isTree(parent) {
+		return db.newDescendantIterator(parent)
+	}
+
+	return db.newBucketIterator(parent.GetDescendantBucket(), db.readYourWrites)
+}
+
+// Iterates over all of the children of l's parent, including l.
+func (db *DB) IterSiblings(l locateable) *Iterator {
+	return db.newChildIterator(l.GetSiblingBucket(), l.GetParentLoc())
+}
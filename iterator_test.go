@@ -0,0 +1,172 @@
+package levTree
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func iterCountTest (t *testing.T, it *Iterator, parent Node, numExpected int) []Node {
+	nodes, err := collectNodes(it)
+
+	if err != nil {
+		t.Error("error iterating: ", err)
+	}
+
+	rangeSearchTest(t, parent, nodes, numExpected)
+
+	return nodes
+}
+
+func keyOrderTest (t *testing.T, nodes []Node) {
+	for i := 1; i < len(nodes); i++ {
+		if bytes.Compare(nodes[i - 1].Key(), nodes[i].Key()) >= 0 {
+			t.Error("iterator did not return nodes in key order")
+		}
+	}
+}
+
+func TestIterators (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	_ = forestTest(t, db, []byte{1})
+
+	t0 := treeTest(t, db, f0, []byte{2})
+
+	b0 := branchTest(t, db, f0, []byte{3})
+
+	b1 := branchTest(t, db, b0, []byte{4})
+
+	_ = branchTest(t, db, b0, []byte{5})
+
+	_ = branchTest(t, db, b1, []byte{6})
+
+	_ = branchTest(t, db, t0, []byte{7})
+
+	iterCountTest(t, db.IterChildren(rootNode), rootNode, 2)
+
+	keyOrderTest(t, iterCountTest(t, db.IterChildren(f0), f0, 2))
+
+	iterCountTest(t, db.IterSiblings(b1), b1, 2)
+
+	// the forest's 6 descendants, the same as GetDescendants.
+	keyOrderTest(t, iterCountTest(t, db.IterDescendants(f0), f0, 6))
+
+	descendants := iterCountTest(t, db.IterDescendants(b0), b0, 3)
+
+	//depth first, so b1's child comes right after it.
+	for i, d := range descendants {
+		if d.Equal(b1.KeyChain) && (i == 2 || !descendants[i + 1].GetParentLoc().Equal(b1.GetLoc())) {
+			t.Error("branch descendants were not depth first")
+		}
+	}
+
+	//stopping early.
+	it := db.IterDescendants(b0)
+
+	if !it.Next() {
+		t.Error("iterator should have a first node: ", it.Err())
+	}
+
+	it.Release()
+
+	if it.Next() {
+		t.Error("released iterator should not move")
+	}
+
+	it.Release()
+}
+
+func TestIteratorReadYourWrites (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	//a long write interval so that nothing leaves the funnel on its own.
+	db, err := Open(path, Options{WriteInterval: time.Hour, ReadYourWrites: true})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	defer db.Close()
+
+	fKc, err := db.NewForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	f, err := db.Get(fKc)
+
+	if err != nil {
+		t.Error("error getting forest: ", err)
+	}
+
+	kcs := make([]locateable, 4)
+
+	for i := range kcs {
+		kcs[i], err = db.NewBranch(f, []byte{byte(i + 1)})
+
+		if err != nil {
+			t.Error("error making branch: ", err)
+		}
+	}
+
+	//one updated, one deleted and one that's only in the funnel.
+	err = db.CompareAndSwap(kcs[0], 0, []byte{10})
+
+	if err != nil {
+		t.Error("error updating branch: ", err)
+	}
+
+	err = db.Delete(kcs[1])
+
+	if err != nil {
+		t.Error("error deleting branch: ", err)
+	}
+
+	pending, err := makeBranch(f, []byte{11})
+
+	if err != nil {
+		t.Error("error making branch: ", err)
+	}
+
+	db.funnel.mutex.Lock()
+	db.bulkPut(pending)
+	db.funnel.mutex.Unlock()
+
+	it := db.IterChildren(f)
+
+	//flushing after the iterator is made shouldn't change what it sees.
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	children := iterCountTest(t, it, f, 4)
+
+	keyOrderTest(t, children)
+
+	for _, c := range children {
+		if c.GetLoc().Equal(kcs[0].GetLoc()) && !bytes.Equal(c.Data, []byte{10}) {
+			t.Error("iterator did not see the update in the funnel: ", c.Data)
+		}
+		if c.GetLoc().Equal(kcs[1].GetLoc()) {
+			t.Error("iterator returned a deleted node")
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package keyChain
+
+/*
+The encoding module turns locations into the keys they're stored under.  A key
+is a version byte followed by each of the location's ids in turn.  An id is its
+height as 8 big endian bytes and then its identifier, with every 0 in the
+identifier escaped as 0 255 and the end of it marked by 0 1.
+
+Since the end of an id can't be mistaken for anything inside of one, no two
+locations share a key and a bucket's key is only ever the start of the keys of
+the locations inside of it.  Escaping doesn't change how identifiers sort, and a
+shorter identifier still sorts before a longer one that starts with it, so
+siblings come off of the db in the same order as their identifiers.
+
+Version 0 keys (from before there was a version) just ran the ids together, with
+no height at all for the root's id.  levTree moves a db's keys to the current
+version when it's opened, see migrate.go.
+
+Because of all that a key can also be read back into its location, and a node's
+location into most of its KeyChain (see KeyChain below), so tools going through
+the db's keys don't have to read the nodes to know where they are.
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+//Returned when reading a key that isn't in the current encoding.
+var ErrKeyVersion = errors.New("keyChain: key is not in the current encoding")
+
+//Returned when reading a key that isn't the key of a location, or the location
+//of a node.
+var ErrMalformedKey = errors.New("keyChain: malformed key")
+
+//The version of the key encoding, which is the first byte of every node's key.
+const KeyVersion byte = 1
+
+const (
+	escapeByte byte = 0x00
+	escapedByte byte = 0xff
+	terminatorByte byte = 0x01
+)
+
+//adds i's encoding to the end of key.
+func (i Id) appendKey (key []byte) []byte {
+	key = append(key, i.heightToByteSlice()...)
+
+	for _, b := range i.Identifier {
+		key = append(key, b)
+
+		if b == escapeByte {
+			key = append(key, escapedByte)
+		}
+	}
+
+	return append(key, escapeByte, terminatorByte)
+}
+
+func (i Id) Key () []byte {
+	return i.appendKey(make([]byte, 0, 10 + len(i.Identifier)))
+}
+
+func (Loc Loc) Key() []byte {
+	key := make([]byte, 0, 1 + len(Loc)*26)
+	key = append(key, KeyVersion)
+
+	for _, id := range Loc {
+		key = id.appendKey(key)
+	}
+
+	return key
+}
+
+//reads the id at the start of key, and returns it along with the rest of key.
+func parseId (key []byte) (Id, []byte, error) {
+	if len(key) < 10 {
+		return Id{}, nil, ErrMalformedKey
+	}
+
+	i := Id{
+		Identifier: make([]byte, 0, len(key) - 10),
+		Height: binary.BigEndian.Uint64(key[:8]),
+	}
+
+	for ind := 8; ind < len(key) - 1; ind++ {
+		if key[ind] != escapeByte {
+			i.Identifier = append(i.Identifier, key[ind])
+			continue
+		}
+
+		ind++
+
+		switch key[ind] {
+		case escapedByte:
+			i.Identifier = append(i.Identifier, escapeByte)
+		case terminatorByte:
+			return i, key[ind + 1:], nil
+		default:
+			return Id{}, nil, ErrMalformedKey
+		}
+	}
+
+	return Id{}, nil, ErrMalformedKey
+}
+
+//every location starts at the root, and ids never get lower.
+func (l Loc) canBeFollowedBy (i Id) bool {
+	if len(l) == 0 {
+		return i.Equal(rootId)
+	}
+
+	return i.Height >= l.GetId().Height
+}
+
+//Reads a key back into the location it was made from.  Works on the keys of
+//buckets as well as those of nodes.
+func ParseKey (key []byte) (Loc, error) {
+	if len(key) == 0 {
+		return nil, ErrMalformedKey
+	}
+
+	if key[0] != KeyVersion {
+		return nil, ErrKeyVersion
+	}
+
+	key = key[1:]
+	l := Loc{}
+
+	for len(key) != 0 {
+		var i Id
+		var err error
+		i, key, err = parseId(key)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !l.canBeFollowedBy(i) {
+			return nil, ErrMalformedKey
+		}
+
+		l = append(l, i)
+	}
+
+	return l, nil
+}
+
+//Rebuilds the KeyChain of the node at l.  A node's location is its namespace,
+//its parent's id and its own id (rule 4), so all of those come back.  The
+//grandparent's id is only in the location when the parent is a tree (result 2),
+//so it's left empty when ParentIsTree is false.  Trees and branches have the
+//same kind of location, so IsTree is only set for the root; it has to be taken
+//from the node, or from a child whose namespace ends in its id.
+func (l Loc) KeyChain () (KeyChain, error) {
+	if l.Equal(rootLoc) {
+		return Root, nil
+	}
+
+	if len(l) < 3 || l[len(l) - 1].Height != l[len(l) - 2].Height + 1 {
+		return KeyChain{}, ErrMalformedKey
+	}
+
+	k := KeyChain{
+		NameSpace: l[:len(l) - 2].copyAndAppend(),
+		ParentId: l[len(l) - 2],
+		Id: l[len(l) - 1],
+	}
+
+	if k.ParentIsTree() && len(k.NameSpace) > 1 {
+		k.GrandParentId = k.NameSpace[len(k.NameSpace) - 2]
+	}
+
+	return k, nil
+}
+
+//Reads the key of a node back into as much of its KeyChain as the key holds.
+//See Loc.KeyChain.
+func ParseKeyChain (key []byte) (KeyChain, error) {
+	l, err := ParseKey(key)
+
+	if err != nil {
+		return KeyChain{}, err
+	}
+
+	return l.KeyChain()
+}
@@ -0,0 +1,147 @@
+package keyChain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyEncoding (t *testing.T) {
+	a := Id{Identifier: []byte{1, 2}, Height: 1}
+	ab := Id{Identifier: []byte{1, 2, 3}, Height: 1}
+	zero := Id{Identifier: []byte{1, 0, 2}, Height: 1}
+	high := Id{Identifier: []byte{1, 2}, Height: 2}
+
+	//an identifier that starts with another's no longer makes a key that does.
+	if bytes.HasPrefix(Loc{ab}.Key(), Loc{a}.Key()) {
+		t.Error("an id's key was the start of a different id's key")
+	}
+
+	//nor can two ids run together into a third.
+	if bytes.Equal(Loc{a, Id{Identifier: []byte{3}, Height: 1}}.Key(), Loc{ab}.Key()) {
+		t.Error("two locations had the same key")
+	}
+
+	//but a bucket's key is the start of everything in it.
+	if !bytes.HasPrefix(Loc{a, ab}.Key(), Loc{a}.Key()) {
+		t.Error("a location's key did not start with its bucket's key")
+	}
+
+	//escaping keeps identifiers in order.
+	ordered := []Loc{
+		rootLoc,
+		Loc{zero},
+		Loc{a},
+		Loc{a, zero},
+		Loc{ab},
+		Loc{high},
+	}
+
+	for i := 1; i < len(ordered); i++ {
+		if bytes.Compare(ordered[i - 1].Key(), ordered[i].Key()) >= 0 {
+			t.Error("keys were not in the order of their ids",
+				"\nfirst: ", ordered[i - 1].Key(),
+				"\nsecond: ", ordered[i].Key())
+		}
+	}
+
+	if Root.Key()[0] != KeyVersion || len(Root.Key()) == 1 {
+		t.Error("the root's key should be the version and the root's id: ", Root.Key())
+	}
+}
+
+func parseTest (t *testing.T, k KeyChain) {
+	l, err := ParseKey(k.Key())
+
+	if err != nil || !l.Equal(k.GetLoc()) {
+		t.Error("key was not read back into its location",
+			"\nexpected: ", k.GetLoc(),
+			"\nfound: ", l,
+			"\nerr: ", err)
+	}
+
+	parsed, err := ParseKeyChain(k.Key())
+
+	if err != nil {
+		t.Error("error reading keychain: ", err)
+	}
+
+	if !parsed.Equal(k) || !parsed.NameSpace.Equal(k.NameSpace) || !parsed.ParentId.Equal(k.ParentId) {
+		t.Error("keychain was not rebuilt from its key",
+			"\nexpected: ", k,
+			"\nfound: ", parsed)
+	}
+
+	if parsed.ParentIsTree() != k.ParentIsTree() {
+		t.Error("rebuilt keychain disagrees about its parent being a tree")
+	}
+
+	//the grandparent is only known under trees.
+	if parsed.ParentIsTree() && !parsed.GrandParentId.Equal(k.GrandParentId) {
+		t.Error("keychain's grandparent was not rebuilt",
+			"\nexpected: ", k.GrandParentId,
+			"\nfound: ", parsed.GrandParentId)
+	}
+
+	if parsed.ParentIsTree() && !parsed.GetParentLoc().Equal(k.GetParentLoc()) {
+		t.Error("rebuilt keychain has the wrong parent")
+	}
+}
+
+func TestParseKey (t *testing.T) {
+	parseTest(t, Root)
+
+	f, _ := Root.MakeChildTree()
+	parseTest(t, f)
+
+	rb, _ := Root.MakeChildBranch()
+	parseTest(t, rb)
+
+	tr, _ := f.MakeChildTree()
+	parseTest(t, tr)
+
+	b, _ := tr.MakeChildBranch()
+	parseTest(t, b)
+
+	bb, _ := b.MakeChildBranch()
+	parseTest(t, bb)
+
+	//identifiers with 0s in them.
+	z := f.Adopt(KeyChain{Id: Id{Identifier: []byte{0, 1, 0, 0xff, 0}}})
+	parseTest(t, z)
+
+	//buckets are locations too.
+	l, err := ParseKey(tr.GetChildBucket().Key())
+
+	if err != nil || !l.Equal(tr.GetChildBucket()) {
+		t.Error("bucket key was not read back into its location: ", err)
+	}
+
+	malformed := [][]byte{
+		nil,
+		{KeyVersion, 0, 0},
+		append(f.Key(), 0),
+		f.Key()[:len(f.Key()) - 1],
+		Loc{f.Id}.Key(),
+	}
+
+	for _, key := range malformed {
+		_, err = ParseKey(key)
+
+		if err != ErrMalformedKey {
+			t.Error("malformed key should not have been read: ", key, err)
+		}
+	}
+
+	_, err = ParseKey(append([]byte{KeyVersion + 1}, f.Key()[1:]...))
+
+	if err != ErrKeyVersion {
+		t.Error("key in another version should not have been read: ", err)
+	}
+
+	//a location that isn't a node's.
+	_, err = ParseKeyChain(f.GetChildBucket().Key())
+
+	if err != ErrMalformedKey {
+		t.Error("bucket should not have been read as a keychain: ", err)
+	}
+}
@@ -0,0 +1,114 @@
+package keyChain
+
+/*
+The generators module makes the identifiers of new ids.  Siblings come off of
+the db in the order of their identifiers, so the choice of generator decides
+the order that children are read in as well as how long their keys are.
+
+UUIDv4 - random, so children come back in no particular order.  This is the
+default.
+
+UUIDv7 - starts with the time it was made, so children come back in the order
+they were made in (and the newest are at the end of their bucket).
+
+ContentHash - a hash of the node's data, so the same data under the same parent
+always gets the same id.  Making a node with the same data as one of its
+siblings fails with levTree.ErrExists, and leaves the sibling as it was.
+
+A counter that's kept on the db is in the levTree package, since it needs the
+db to keep it on.
+*/
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/nu7hatch/gouuid"
+	"sync"
+	"time"
+)
+
+//Returned when a generator makes an empty identifier, which would give a node
+//the same key as its parent's bucket.
+var ErrEmptyIdentifier = errors.New("keyChain: generated identifier is empty")
+
+//Makes the identifiers of new ids.  data is the data of the node the id is
+//for.  Identifiers from the same generator must never be the start of one
+//another, so that a bucket's keys never run into each other's.
+type IdGenerator interface {
+	NewIdentifier(data []byte) ([]byte, error)
+}
+
+//Random version 4 UUIDs.
+type UUIDv4 struct{}
+
+func (UUIDv4) NewIdentifier(data []byte) ([]byte, error) {
+	identifier, err := uuid.NewV4()
+
+	if err != nil {
+		fmt.Println("UUID GENERATOR ERROR: ", err)
+		return nil, err
+	}
+
+	return identifier[:], nil
+}
+
+//Version 7 UUIDs, which start with the millisecond they were made in.  Ones
+//made in the same millisecond by the same generator still sort in the order
+//they were made.  Use NewUUIDv7 to make one.
+type UUIDv7 struct {
+	mutex sync.Mutex
+	last [16]byte
+}
+
+func NewUUIDv7() *UUIDv7 {
+	return new(UUIDv7)
+}
+
+func (g *UUIDv7) NewIdentifier(data []byte) ([]byte, error) {
+	var identifier [16]byte
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint64(identifier[:8], ms << 16)
+
+	_, err := rand.Read(identifier[6:])
+
+	if err != nil {
+		fmt.Println("UUID GENERATOR ERROR: ", err)
+		return nil, err
+	}
+
+	identifier[6] = 0x70 | identifier[6] & 0x0f //version
+	identifier[8] = 0x80 | identifier[8] & 0x3f //variant
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	//the clock hasn't moved on (or has gone back), so count up from the
+	//last one instead.
+	if bytes.Compare(identifier[:], g.last[:]) <= 0 {
+		identifier = g.last
+
+		for i := len(identifier) - 1; i > 8; i-- {
+			identifier[i]++
+			if identifier[i] != 0 {
+				break
+			}
+		}
+	}
+
+	g.last = identifier
+
+	return identifier[:], nil
+}
+
+//The first 16 bytes of the SHA-256 of the node's data.
+type ContentHash struct{}
+
+func (ContentHash) NewIdentifier(data []byte) ([]byte, error) {
+	hash := sha256.Sum256(data)
+	return hash[:16], nil
+}
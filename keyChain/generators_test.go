@@ -0,0 +1,47 @@
+package keyChain
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerators (t *testing.T) {
+	v7 := NewUUIDv7()
+
+	var last []byte
+
+	//many will be made in the same millisecond.
+	for i := 0; i < 1000; i++ {
+		identifier, err := v7.NewIdentifier(nil)
+
+		if err != nil {
+			t.Error("error making UUIDv7: ", err)
+		}
+
+		if len(identifier) != 16 || identifier[6] >> 4 != 7 {
+			t.Error("not a version 7 UUID: ", identifier)
+		}
+
+		if bytes.Compare(last, identifier) >= 0 {
+			t.Error("UUIDv7s were not made in order",
+				"\nlast: ", last,
+				"\nnext: ", identifier)
+		}
+
+		last = identifier
+	}
+
+	h0, _ := ContentHash{}.NewIdentifier([]byte("data"))
+	h1, _ := ContentHash{}.NewIdentifier([]byte("data"))
+	h2, _ := ContentHash{}.NewIdentifier([]byte("other data"))
+
+	if !bytes.Equal(h0, h1) || bytes.Equal(h0, h2) {
+		t.Error("content hashes should only match for the same data")
+	}
+
+	v4, err := UUIDv4{}.NewIdentifier(nil)
+
+	if err != nil || len(v4) != 16 {
+		t.Error("error making UUIDv4: ", err)
+	}
+}
@@ -1,8 +1,7 @@
 package keyChain
 
 import (
-	"fmt"
-	"github.com/nu7hatch/gouuid"
+	"encoding/binary"
 	"bytes"
 )
 
@@ -24,9 +23,6 @@ var bitwiseConverters []uint64 = []uint64{
 }
 
 func (i Id) heightToByteSlice () []byte {
-	if(i.Height == 0) {
-		return nil
-	}
 	byteSlice := make([]byte, 8)
 
 	for ind := range byteSlice {
@@ -36,20 +32,24 @@ func (i Id) heightToByteSlice () []byte {
 	return byteSlice
 }
 
-func (i Id) Key () []byte {
-	return append(i.heightToByteSlice(), i.Identifier...)
+//Reads the height of the id at the start of key.
+//Returns false if key is too short to start with an id.
+func FirstHeight (key []byte) (uint64, bool) {
+	if len(key) < 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(key[:8]), true
 }
 
 func makeId (h uint64) (Id, error) {
-	identifier, err := uuid.NewV4()
+	identifier, err := UUIDv4{}.NewIdentifier(nil)
 
 	if err != nil {
-		fmt.Println("UUID GENERATOR ERROR: ", err)
 		return Id{}, err
 	}
 
 	i := Id{
-		Identifier: identifier[:],
+		Identifier: identifier,
 		Height: h,
 	}
 
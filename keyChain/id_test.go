@@ -151,7 +151,8 @@ func TestRootId (t *testing.T) {
 		t.Error("childHeight is not correct: ", i.Height)
 	}
 
-	if len(i.Key()) != 24 {
+	//8 bytes of height, the 16 byte identifier (with any 0s escaped) and 2 to end it.
+	if len(i.Key()) != 26 + bytes.Count(i.Identifier, []byte{0}) {
 		t.Error("there were not the right number of bytes in the new id's key: ", len(i.Key()))
 	}
 
@@ -1,8 +1,16 @@
 package keyChain
 
 import (
+	"errors"
 	"fmt"
 )
+
+//Returned when trying to make a sibling of the root, which has no parent.
+var ErrRootSibling = errors.New("keyChain: the root can't have siblings")
+
+//Returned when a tree would end up under a branch, which breaks rule 1.
+var ErrTreeUnderBranch = errors.New("keyChain: trees can't be the descendants of branches")
+
 //A keyChain keeps track of any number of nested buckets and an Id which can be
 //translated into a byte slice key.
 // type KeyChain struct {
@@ -118,12 +126,52 @@ func (parent KeyChain) MakeChildTree () (KeyChain, error) {
 	return child, err
 }
 
+//Makes a new keychain with the same parent as k, and so in the same bucket as
+//k.  The new keychain is a tree if k is.
 func (k KeyChain) MakeSibling () (KeyChain, error) {
+	if k.Equal(Root) {
+		fmt.Println("error making sibling: ", ErrRootSibling)
+		return KeyChain{}, ErrRootSibling
+	}
+
 	var err error
-	k.Id, err = k.ParentId.makeChildId()
+	k.Id, err = k.Id.makeSiblingId()
 	return k, err
 }
 
+func (k KeyChain) MakeSiblingBranch () (KeyChain, error) {
+	sibling, err := k.MakeSibling()
+	sibling.IsTree = false
+	return sibling, err
+}
+
+//Fails with ErrTreeUnderBranch if k's parent is a branch (rule 1).
+func (k KeyChain) MakeSiblingTree () (KeyChain, error) {
+	if !k.ParentIsTree() {
+		fmt.Println("error making sibling tree: ", ErrTreeUnderBranch)
+		return KeyChain{}, ErrTreeUnderBranch
+	}
+
+	sibling, err := k.MakeSibling()
+	sibling.IsTree = true
+	return sibling, err
+}
+
+//Makes a keychain for child as a child of parent.  The child keeps its
+//identifier and whether it's a tree, but its height and namespace are worked
+//out again from parent, so this is how a keychain is moved to a new parent.
+//Any descendants of child have to be adopted by the new keychain in turn.
+func (parent KeyChain) Adopt (child KeyChain) KeyChain {
+	child.NameSpace = parent.childNameSpace()
+	child.GrandParentId = parent.ParentId
+	child.ParentId = parent.Id
+	child.Id = Id{
+		Identifier: child.Identifier,
+		Height: parent.Id.Height + 1,
+	}
+	return child
+}
+
 func (k KeyChain) ParentIsTree () bool {
 	if k.Equal(Root) {
 		return true
@@ -131,6 +179,34 @@ func (k KeyChain) ParentIsTree () bool {
 	return k.NameSpace[len(k.NameSpace) - 1].Equal(k.ParentId)
 }
 
+//Gets the locations of the trees in k's namespace, which are all of k's tree
+//ancestors, nearest first.  Since trees can only be the children of trees
+//(rule 1), each one's location follows from the one before it, so none of them
+//need to be looked up.
+func (k KeyChain) GetTreeAncestors() []Loc {
+	locs := make([]Loc, 0, len(k.NameSpace))
+
+	for i := len(k.NameSpace) - 1; i > 0; i-- {
+		locs = append(locs, k.NameSpace[:i].copyAndAppend(k.NameSpace[i - 1], k.NameSpace[i]))
+	}
+
+	return locs
+}
+
+//Gets the id of the forest that k is in, which is k's own id if k is a forest.
+//Returns false for the root and for branches that are attached to the root.
+func (k KeyChain) ForestId() (Id, bool) {
+	if len(k.NameSpace) > 1 {
+		return k.NameSpace[1], true
+	}
+
+	if k.IsTree && k.ParentId.Equal(rootId) && !k.Equal(Root) {
+		return k.Id, true
+	}
+
+	return Id{}, false
+}
+
 //Converts the KeyChain into a single byte slice
 func (k KeyChain) Key() []byte {
 	return k.GetLoc().Key()
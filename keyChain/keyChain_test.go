@@ -643,4 +643,169 @@ func TestPassThroughFunctions (t *testing.T) {
 	}
 
 
-}
\ No newline at end of file
+}
+func TestMakeSiblingKind (t *testing.T) {
+	tree, err := Root.MakeChildTree()
+
+	if err != nil {
+		t.Error("error making tree: ", err)
+	}
+
+	branch, err := tree.MakeSiblingBranch()
+
+	if err != nil {
+		t.Error("error making sibling branch: ", err)
+	}
+
+	if branch.IsTree {
+		t.Error("sibling branch of a tree should not be a tree")
+	}
+
+	if branch.Id.Height != tree.Id.Height {
+		t.Error("sibling should be at the same height",
+			"\noriginal: ", tree.Id.Height,
+			"\nsibling: ", branch.Id.Height)
+	}
+
+	if !branch.GetSiblingBucket().Equal(tree.GetSiblingBucket()) {
+		t.Error("sibling branch is not in the original's sibling bucket")
+	}
+
+	tree2, err := branch.MakeSiblingTree()
+
+	if err != nil {
+		t.Error("error making sibling tree: ", err)
+	}
+
+	if !tree2.IsTree {
+		t.Error("sibling tree of a branch should be a tree")
+	}
+
+	if !tree2.GetParentLoc().Equal(tree.GetParentLoc()) {
+		t.Error("sibling tree has the wrong parent: ", tree2.GetParentLoc())
+	}
+
+	child, err := branch.MakeChildBranch()
+
+	if err != nil {
+		t.Error("error making child branch: ", err)
+	}
+
+	_, err = child.MakeSiblingTree()
+
+	if err != ErrTreeUnderBranch {
+		t.Error("sibling tree under a branch should fail, but returned: ", err)
+	}
+
+	_, err = Root.MakeSibling()
+
+	if err != ErrRootSibling {
+		t.Error("making a sibling of the root should fail, but returned: ", err)
+	}
+}
+
+func adoptTest (t *testing.T, parent KeyChain, child KeyChain) KeyChain {
+	adopted := parent.Adopt(child)
+
+	if !bytes.Equal(adopted.Identifier, child.Identifier) {
+		t.Error("adopted keychain should keep its identifier")
+	}
+
+	if adopted.IsTree != child.IsTree {
+		t.Error("adopted keychain should stay a tree or a branch")
+	}
+
+	if !adopted.GetParentLoc().Equal(parent.GetLoc()) {
+		t.Error("adopted keychain has the wrong parent",
+			"\nexpected: ", parent.GetLoc(),
+			"\ncomputed: ", adopted.GetParentLoc())
+	}
+
+	//a new child of parent should be in exactly the same place.
+	fresh, err := parent.makeChild()
+
+	if err != nil {
+		t.Error("error making child: ", err)
+	}
+
+	fresh.IsTree = child.IsTree
+	fresh.Id.Identifier = child.Identifier
+
+	if !adopted.Equal(fresh) || !adopted.GetChildBucket().Equal(fresh.GetChildBucket()) {
+		t.Error("adopted keychain is not where a new child would be",
+			"\nexpected: ", fresh.GetLoc(),
+			"\ncomputed: ", adopted.GetLoc())
+	}
+
+	return adopted
+}
+
+func TestAdopt (t *testing.T) {
+	f0, _ := Root.MakeChildTree()
+	b0, _ := f0.MakeChildBranch()
+	b1, _ := b0.MakeChildBranch()
+	t0, _ := b1.MakeChildTree()
+
+	f1, _ := Root.MakeChildTree()
+	t1, _ := f1.MakeChildTree()
+	t2, _ := t1.MakeChildTree()
+
+	//move b0 down a level and into another forest.
+	newB0 := adoptTest(t, t2, b0)
+	newB1 := adoptTest(t, newB0, b1)
+	_ = adoptTest(t, newB1, t0)
+
+	//move t1 up to the root and b1 under it.
+	newT1 := adoptTest(t, Root, t1)
+	_ = adoptTest(t, newT1, b1)
+}
+
+func TestGetTreeAncestors (t *testing.T) {
+	f0, _ := Root.MakeChildTree()
+	t0, _ := f0.MakeChildTree()
+	t1, _ := t0.MakeChildTree()
+	b0, _ := t1.MakeChildBranch()
+	b1, _ := b0.MakeChildBranch()
+
+	expected := []Loc{t1.GetLoc(), t0.GetLoc(), f0.GetLoc()}
+
+	for _, k := range []KeyChain{b0, b1} {
+		ancestors := k.GetTreeAncestors()
+
+		if len(ancestors) != len(expected) {
+			t.Fatal("wrong number of tree ancestors: ", len(ancestors))
+		}
+
+		for i, loc := range ancestors {
+			if !loc.Equal(expected[i]) {
+				t.Error("tree ancestor has the wrong location",
+					"\nexpected: ", expected[i],
+					"\ncomputed: ", loc)
+			}
+		}
+	}
+
+	if len(f0.GetTreeAncestors()) != 0 || len(Root.GetTreeAncestors()) != 0 {
+		t.Error("forests and the root have no tree ancestors")
+	}
+}
+
+func TestFirstHeight (t *testing.T) {
+	f0, _ := Root.MakeChildTree()
+	t0, _ := f0.MakeChildTree()
+	b0, _ := t0.MakeChildBranch()
+
+	key := b0.Key()[len(t0.GetDescendantBucket().Key()):]
+
+	h, ok := FirstHeight(key)
+
+	if !ok || h != t0.Id.Height {
+		t.Error("read the wrong height: ", h, ok)
+	}
+
+	_, ok = FirstHeight(key[:7])
+
+	if ok {
+		t.Error("a key shorter than a height shouldn't have one")
+	}
+}
@@ -2,8 +2,8 @@ package keyChain
 
 /*
 The location module provides a bucketing system for namespacing keys.  Id
-generation defaults to guuid V4, which is sufficient for my usecase, but other
-options may be added later.
+generation defaults to guuid V4; other generators are in generators.go.  How a
+location becomes a key is in encoding.go.
 */
 
 import (
@@ -19,16 +19,6 @@ func (l Loc) copyAndAppend (Ids ...Id) Loc {
 	return newL
 }
 
-func (Loc Loc) Key() []byte {
-	key := make([]byte, 0, len(Loc)*8)
-
-	for _, id := range Loc {
-		key = append(key, id.Key()...)
-	}
-
-	return key
-}
-
 func (loc Loc) KeyString() string {
 	return string(loc.Key())
 }
@@ -0,0 +1,267 @@
+package keyChain
+
+/*
+The position module makes ids for ordered children.  Siblings' keys only differ
+by their ids, so siblings come off of the db in the order of their
+identifiers.  An ordered child's identifier starts with its position, which
+can be made to sort between any two other positions, so a child can be put
+anywhere among its siblings without changing any of theirs.
+
+A position is an integer followed by a fraction.  The integer is a head byte
+that says how many digits it has and which side of 0 it's on (128 is 0, 128+n
+is a positive integer with n digits and 128-n is a negative one), then the
+digits, in base 255 from 1 to 255.  Negative integers count down from the top
+of their width so that they still sort.  Putting a child first or last just
+takes the integer one lower or one higher than the ends', so positions only
+grow a byte for every 255 times longer the list gets.  The fraction is only
+used between two positions with the same integer, and is a string of bytes
+from 1 to 255 that never ends in 1, so there's always room between two of them.
+
+Nothing in a position is ever 0, so an ordered identifier is the position, a 0
+to end it and then some random bytes, so that two children given the same
+position still get different ids.  The 0 also means one identifier is never
+the start of another.
+*/
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+)
+
+//the number of random bytes after an ordered identifier's position.
+const positionSuffixLength int = 8
+
+//Returned when reading a position that wasn't made by PositionBetween.
+var ErrMalformedPosition = errors.New("keyChain: malformed position")
+
+const (
+	//the head of the integer 0, with no digits after it.
+	zeroHead int = 128
+
+	//the base the integer's digits are in.  Digits are stored one higher,
+	//so that none of them are 0.
+	digitBase int64 = 255
+
+	//the most digits an integer can have, so that it fits in an int64.
+	maxDigits int = 7
+)
+
+//the smallest number that takes n+1 digits.
+func widthLimit(n int) int64 {
+	limit := int64(1)
+
+	for i := 0; i < n; i++ {
+		limit *= digitBase
+	}
+
+	return limit
+}
+
+//writes i as the integer part of a position.
+func appendInteger(p []byte, i int64) ([]byte, error) {
+	if i == 0 {
+		return append(p, byte(zeroHead)), nil
+	}
+
+	abs := i
+
+	if i < 0 {
+		abs = -i
+	}
+
+	n := 1
+
+	for abs >= widthLimit(n) {
+		n++
+
+		if n > maxDigits {
+			return nil, ErrMalformedPosition
+		}
+	}
+
+	v := abs
+	head := zeroHead + n
+
+	//negative integers count down from the top of their width.
+	if i < 0 {
+		v = widthLimit(n) - abs
+		head = zeroHead - n
+	}
+
+	p = append(p, byte(head))
+
+	for d := n - 1; d >= 0; d-- {
+		p = append(p, byte(v / widthLimit(d) % digitBase + 1))
+	}
+
+	return p, nil
+}
+
+//reads the integer at the start of p, and returns it along with the fraction
+//after it.
+func splitPosition(p []byte) (int64, []byte, error) {
+	if len(p) == 0 || p[0] == 0 {
+		return 0, nil, ErrMalformedPosition
+	}
+
+	head := int(p[0])
+
+	if head == zeroHead {
+		return 0, p[1:], nil
+	}
+
+	n := head - zeroHead
+
+	if head < zeroHead {
+		n = zeroHead - head
+	}
+
+	if n > maxDigits || len(p) < n + 1 {
+		return 0, nil, ErrMalformedPosition
+	}
+
+	v := int64(0)
+
+	for _, digit := range p[1:n + 1] {
+		if digit == 0 {
+			return 0, nil, ErrMalformedPosition
+		}
+
+		v = v * digitBase + int64(digit) - 1
+	}
+
+	if head < zeroHead {
+		return v - widthLimit(n), p[n + 1:], nil
+	}
+
+	return v, p[n + 1:], nil
+}
+
+//makes a fraction that sorts after lo and before hi.  A nil hi is after every
+//fraction.
+func fractionBetween (lo, hi []byte) []byte {
+	p := make([]byte, 0, len(lo) + 1)
+
+	for i := 0; ; i++ {
+		l := 0
+		if i < len(lo) {
+			l = int(lo[i])
+		}
+
+		h := 256
+		if hi != nil && i < len(hi) {
+			h = int(hi[i])
+		}
+
+		if h - l > 1 {
+			mid := (l + h) / 2
+			p = append(p, byte(mid))
+
+			//fractions can't end in 1.
+			if mid == 1 {
+				p = append(p, 128)
+			}
+
+			return p
+		}
+
+		if l == 0 {
+			//lo has run out, so follow hi down until there's room.
+			p = append(p, byte(h))
+			continue
+		}
+
+		p = append(p, byte(l))
+
+		//p is now before hi no matter what comes next.
+		if h != l {
+			hi = nil
+		}
+	}
+}
+
+//Makes a position that sorts after lo and before hi.  A nil lo is before every
+//position and a nil hi is after every position.  lo must sort before hi, and
+//both must have been made by PositionBetween.
+func PositionBetween (lo, hi []byte) ([]byte, error) {
+	if lo == nil && hi == nil {
+		return appendInteger(nil, 0)
+	}
+
+	if hi == nil {
+		loInt, _, err := splitPosition(lo)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return appendInteger(nil, loInt + 1)
+	}
+
+	hiInt, hiFraction, err := splitPosition(hi)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if lo == nil {
+		return appendInteger(nil, hiInt - 1)
+	}
+
+	loInt, loFraction, err := splitPosition(lo)
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	//there's an integer between them.
+	case hiInt - loInt > 1:
+		return appendInteger(nil, loInt + 1)
+	//hi's integer is before hi.
+	case hiInt > loInt && len(hiFraction) != 0:
+		return appendInteger(nil, hiInt)
+	//nothing after lo's integer is before hi.
+	case hiInt > loInt:
+		hiFraction = nil
+	}
+
+	p, err := appendInteger(nil, loInt)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return append(p, fractionBetween(loFraction, hiFraction)...), nil
+}
+
+//Gets the position at the start of an ordered identifier.
+func (i Id) Position () []byte {
+	end := bytes.IndexByte(i.Identifier, 0)
+
+	if end == -1 {
+		return i.Identifier
+	}
+
+	return i.Identifier[:end]
+}
+
+//Makes an ordered id at height h that sorts at position.
+func MakePositionId (h uint64, position []byte) (Id, error) {
+	identifier := make([]byte, len(position) + 1 + positionSuffixLength)
+	copy(identifier, position)
+
+	_, err := rand.Read(identifier[len(position) + 1:])
+
+	if err != nil {
+		fmt.Println("error making position suffix: ", err)
+		return Id{}, err
+	}
+
+	return Id{
+		Identifier: identifier,
+		Height: h,
+	}, nil
+}
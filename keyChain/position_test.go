@@ -0,0 +1,148 @@
+package keyChain
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func positionTest (t *testing.T, lo, hi, p []byte) {
+	if lo != nil && bytes.Compare(lo, p) >= 0 {
+		t.Error("position is not after lo",
+			"\nlo: ", lo,
+			"\nposition: ", p)
+	}
+
+	if hi != nil && bytes.Compare(p, hi) >= 0 {
+		t.Error("position is not before hi",
+			"\nhi: ", hi,
+			"\nposition: ", p)
+	}
+
+	_, fraction, err := splitPosition(p)
+
+	if err != nil || bytes.IndexByte(p, 0) != -1 || (len(fraction) != 0 && fraction[len(fraction) - 1] == 1) {
+		t.Error("position is not well formed: ", p)
+	}
+}
+
+//makes a position between lo and hi and checks it.
+func between (t *testing.T, lo, hi []byte) []byte {
+	p, err := PositionBetween(lo, hi)
+
+	if err != nil {
+		t.Fatal("error making position: ", err)
+	}
+
+	positionTest(t, lo, hi, p)
+
+	return p
+}
+
+func TestPositionBetween (t *testing.T) {
+	positions := [][]byte{between(t, nil, nil)}
+
+	//always putting the new position first, last or right after the first
+	//finds the edge cases quickly.
+	for i := 0; i < 2000; i++ {
+		var index int
+
+		switch rand.Intn(4) {
+		case 0:
+			index = 0
+		case 1:
+			index = len(positions)
+		case 2:
+			index = 1
+		default:
+			index = rand.Intn(len(positions) + 1)
+		}
+
+		var lo, hi []byte
+
+		if index > 0 {
+			lo = positions[index - 1]
+		}
+
+		if index < len(positions) {
+			hi = positions[index]
+		}
+
+		p := between(t, lo, hi)
+
+		positions = append(positions, nil)
+		copy(positions[index + 1:], positions[index:])
+		positions[index] = p
+	}
+}
+
+func TestPositionGrowth (t *testing.T) {
+	first := between(t, nil, nil)
+	last := first
+
+	//putting things at the ends only grows positions a byte for every 255
+	//times longer the list gets.
+	for i := 0; i < 10000; i++ {
+		first = between(t, nil, first)
+		last = between(t, last, nil)
+	}
+
+	if len(first) > 3 || len(last) > 3 {
+		t.Error("positions at the ends grew too quickly",
+			"\nfirst: ", first,
+			"\nlast: ", last)
+	}
+
+	//and they still come back as the integers they were made from.
+	for _, i := range []int64{0, 1, -1, 254, 255, -254, -255, 65024, 65025, -65025, 1 << 40, -(1 << 40)} {
+		p, err := appendInteger(nil, i)
+
+		if err != nil {
+			t.Error("error writing integer: ", err)
+		}
+
+		read, fraction, err := splitPosition(p)
+
+		if err != nil || read != i || len(fraction) != 0 {
+			t.Error("integer was not read back: ", i, read, err)
+		}
+
+		next, _ := appendInteger(nil, i + 1)
+
+		if bytes.Compare(p, next) >= 0 {
+			t.Error("integers are out of order: ", i, p, next)
+		}
+	}
+
+	_, err := PositionBetween([]byte{200}, nil)
+
+	if err != ErrMalformedPosition {
+		t.Error("malformed position should not have been read: ", err)
+	}
+}
+
+func TestPositionId (t *testing.T) {
+	p := between(t, nil, nil)
+
+	id1, err := MakePositionId(2, p)
+
+	if err != nil {
+		t.Error("error making position id: ", err)
+	}
+
+	id2, _ := MakePositionId(2, p)
+
+	if id1.Equal(id2) {
+		t.Error("ids at the same position should still be different")
+	}
+
+	if !bytes.Equal(id1.Position(), p) {
+		t.Error("id has the wrong position: ", id1.Position())
+	}
+
+	later, _ := MakePositionId(2, between(t, p, nil))
+
+	if bytes.Compare(id1.Key(), later.Key()) >= 0 || bytes.HasPrefix(later.Key(), id1.Key()) {
+		t.Error("ids don't sort by position")
+	}
+}
@@ -0,0 +1,200 @@
+package keyChain
+
+/*
+The text module writes locations and keychains as text, for passing them
+around in URLs, logs and config files.  An id is its height in decimal, a dot
+and then its identifier in base32 (the hex alphabet without padding, so ids
+still sort by identifier).  The root's id is "0.".  A location is each of its
+ids with a slash in front, so the root's location is "/0." and the empty
+location is "".
+
+A keychain is a "t" for a tree or a "b" for a branch followed by its location.
+A location holds all of a keychain apart from its grandparent's id when its
+parent is a branch (see Loc.KeyChain), so in that case the grandparent's id
+comes last after a "~".  Nothing but letters, digits and . / ~ are used, and a
+keychain always comes back from its text exactly as it was.
+*/
+
+import (
+	"encoding/base32"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+//Returned when reading text that isn't a location or keychain.
+var ErrMalformedText = errors.New("keyChain: malformed text")
+
+var identifierEncoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+func (i Id) String () string {
+	return strconv.FormatUint(i.Height, 10) + "." + identifierEncoding.EncodeToString(i.Identifier)
+}
+
+func parseIdText (s string) (Id, error) {
+	dot := strings.IndexByte(s, '.')
+
+	if dot == -1 {
+		return Id{}, ErrMalformedText
+	}
+
+	h, err := strconv.ParseUint(s[:dot], 10, 64)
+
+	if err != nil || strconv.FormatUint(h, 10) != s[:dot] {
+		return Id{}, ErrMalformedText
+	}
+
+	identifier, err := identifierEncoding.DecodeString(s[dot + 1:])
+
+	if err != nil {
+		return Id{}, ErrMalformedText
+	}
+
+	return Id{
+		Identifier: identifier,
+		Height: h,
+	}, nil
+}
+
+func (l Loc) String () string {
+	var s strings.Builder
+
+	for _, i := range l {
+		s.WriteByte('/')
+		s.WriteString(i.String())
+	}
+
+	return s.String()
+}
+
+//Reads the text of a location back into the location.
+func ParseLoc (s string) (Loc, error) {
+	l := Loc{}
+
+	if s == "" {
+		return l, nil
+	}
+
+	if s[0] != '/' {
+		return nil, ErrMalformedText
+	}
+
+	for _, idText := range strings.Split(s[1:], "/") {
+		i, err := parseIdText(idText)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !l.canBeFollowedBy(i) {
+			return nil, ErrMalformedText
+		}
+
+		l = append(l, i)
+	}
+
+	return l, nil
+}
+
+func (l Loc) MarshalText () ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Loc) UnmarshalText (text []byte) error {
+	parsed, err := ParseLoc(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*l = parsed
+
+	return nil
+}
+
+func (k KeyChain) String () string {
+	kind := "b"
+
+	if k.IsTree {
+		kind = "t"
+	}
+
+	s := kind + k.GetLoc().String()
+
+	if !k.Equal(Root) && !k.ParentIsTree() {
+		s += "~" + k.GrandParentId.String()
+	}
+
+	return s
+}
+
+//Reads the text of a keychain back into the keychain.
+func ParseKeyChainText (s string) (KeyChain, error) {
+	if len(s) == 0 || (s[0] != 't' && s[0] != 'b') {
+		return KeyChain{}, ErrMalformedText
+	}
+
+	isTree := s[0] == 't'
+	s = s[1:]
+
+	gpText := ""
+	tilde := strings.IndexByte(s, '~')
+
+	if tilde != -1 {
+		gpText = s[tilde + 1:]
+		s = s[:tilde]
+	}
+
+	l, err := ParseLoc(s)
+
+	if err != nil {
+		return KeyChain{}, err
+	}
+
+	k, err := l.KeyChain()
+
+	if err != nil {
+		return KeyChain{}, ErrMalformedText
+	}
+
+	if k.Equal(Root) {
+		if !isTree || tilde != -1 {
+			return KeyChain{}, ErrMalformedText
+		}
+
+		return k, nil
+	}
+
+	k.IsTree = isTree
+
+	//the grandparent is there when, and only when, it isn't in the location.
+	if k.ParentIsTree() != (tilde == -1) {
+		return KeyChain{}, ErrMalformedText
+	}
+
+	if tilde != -1 {
+		k.GrandParentId, err = parseIdText(gpText)
+
+		if err != nil {
+			return KeyChain{}, err
+		}
+	}
+
+	return k, nil
+}
+
+func (k KeyChain) MarshalText () ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+func (k *KeyChain) UnmarshalText (text []byte) error {
+	parsed, err := ParseKeyChainText(string(text))
+
+	if err != nil {
+		return err
+	}
+
+	*k = parsed
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package keyChain
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+func textTest (t *testing.T, k KeyChain) {
+	parsed, err := ParseKeyChainText(k.String())
+
+	if err != nil {
+		t.Error("error reading keychain text: ", k.String(), err)
+	}
+
+	if parsed.IsTree != k.IsTree || !parsed.NameSpace.Equal(k.NameSpace) ||
+		!parsed.GrandParentId.Equal(k.GrandParentId) || !parsed.ParentId.Equal(k.ParentId) ||
+		!parsed.Id.Equal(k.Id) {
+		t.Error("keychain did not come back from its text",
+			"\nexpected: ", k,
+			"\nfound: ", parsed)
+	}
+
+	l, err := ParseLoc(k.GetLoc().String())
+
+	if err != nil || !l.Equal(k.GetLoc()) {
+		t.Error("location did not come back from its text: ", k.GetLoc().String(), err)
+	}
+
+	//through JSON and a query string.
+	b, err := json.Marshal(map[string]KeyChain{"k": k})
+
+	if err != nil {
+		t.Error("error marshaling keychain: ", err)
+	}
+
+	var m map[string]KeyChain
+	err = json.Unmarshal(b, &m)
+
+	if err != nil || !m["k"].Equal(k) || m["k"].IsTree != k.IsTree || !m["k"].GrandParentId.Equal(k.GrandParentId) {
+		t.Error("keychain did not come back from JSON: ", string(b), err)
+	}
+
+	q, err := url.ParseQuery(url.Values{"k": {k.String()}}.Encode())
+
+	if err != nil || q.Get("k") != k.String() {
+		t.Error("keychain text did not come back from a query string: ", err)
+	}
+}
+
+func TestText (t *testing.T) {
+	textTest(t, Root)
+
+	if Root.String() != "t/0." {
+		t.Error("the root's text should be t/0., but was: ", Root.String())
+	}
+
+	f, _ := Root.MakeChildTree()
+	textTest(t, f)
+
+	rb, _ := Root.MakeChildBranch()
+	textTest(t, rb)
+
+	tr, _ := f.MakeChildTree()
+	textTest(t, tr)
+
+	b, _ := tr.MakeChildBranch()
+	textTest(t, b)
+
+	//its grandparent isn't in its location, so it's written after it.
+	bb, _ := b.MakeChildBranch()
+	textTest(t, bb)
+
+	z := f.Adopt(KeyChain{Id: Id{Identifier: []byte{0, 1, 0, 0xff, 0}}})
+	textTest(t, z)
+
+	l, err := ParseLoc("")
+
+	if err != nil || len(l) != 0 {
+		t.Error("empty text should be the empty location: ", l, err)
+	}
+
+	var lj Loc
+	err = json.Unmarshal([]byte(`"` + tr.GetChildBucket().String() + `"`), &lj)
+
+	if err != nil || !lj.Equal(tr.GetChildBucket()) {
+		t.Error("location did not come back from JSON: ", err)
+	}
+
+	malformed := []string{
+		"",
+		"x/0.",
+		"t0.",
+		"b/0.",
+		"t/0./",
+		"t/01./0./1.",
+		"t/0./0./1.!",
+		"t/1.AB",
+		f.String() + "~0.",
+		"b" + bb.GetLoc().String(),
+		rb.String() + "/3.",
+	}
+
+	for _, s := range malformed {
+		_, err = ParseKeyChainText(s)
+
+		if err != ErrMalformedText {
+			t.Error("malformed text should not have been read: ", s, err)
+		}
+	}
+}
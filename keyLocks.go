@@ -0,0 +1,82 @@
+package levTree
+
+/*
+The keyLocks module lets updates lock only the nodes that they touch, so that
+updates to unrelated nodes don't have to wait on each other.  Locks are made
+when they're first asked for and thrown away once nobody holds or is waiting
+on them, so there's never more of them than there are nodes being updated.
+
+Any update that needs more than one node takes its locks in key order, which
+means two updates can never each hold a lock that the other is waiting on.
+*/
+
+import (
+	"sort"
+	"sync"
+)
+
+type keyLocks struct {
+	mutex sync.Mutex
+	locks map[string]*keyLock
+}
+
+type keyLock struct {
+	mutex sync.Mutex
+	//the number of goroutines holding or waiting on this lock.
+	refs int
+}
+
+func newKeyLocks() *keyLocks {
+	return &keyLocks{
+		locks: make(map[string]*keyLock),
+	}
+}
+
+//sorts keys and removes any duplicates, so that locks are always taken in the
+//same order and never taken twice by the same update.
+func lockOrder(keys []string) []string {
+	ordered := make([]string, len(keys))
+	copy(ordered, keys)
+	sort.Strings(ordered)
+
+	unique := ordered[:0]
+
+	for i, k := range ordered {
+		if i == 0 || k != ordered[i-1] {
+			unique = append(unique, k)
+		}
+	}
+
+	return unique
+}
+
+//blocks until it holds the locks for all of keys.
+func (kl *keyLocks) lock(keys ...string) {
+	for _, k := range lockOrder(keys) {
+		kl.mutex.Lock()
+		l, exists := kl.locks[k]
+		if !exists {
+			l = new(keyLock)
+			kl.locks[k] = l
+		}
+		l.refs++
+		kl.mutex.Unlock()
+
+		l.mutex.Lock()
+	}
+}
+
+//releases the locks for all of keys.  They must all be held.
+func (kl *keyLocks) unlock(keys ...string) {
+	kl.mutex.Lock()
+	defer kl.mutex.Unlock()
+
+	for _, k := range lockOrder(keys) {
+		l := kl.locks[k]
+		l.mutex.Unlock()
+		l.refs--
+		if l.refs == 0 {
+			delete(kl.locks, k)
+		}
+	}
+}
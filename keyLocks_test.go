@@ -0,0 +1,38 @@
+package levTree
+
+import (
+	"testing"
+)
+
+func TestLockOrder (t *testing.T) {
+	ordered := lockOrder([]string{"c", "a", "b", "a", "c"})
+
+	expected := []string{"a", "b", "c"}
+
+	if len(ordered) != len(expected) {
+		t.Error("lock order should have removed duplicates: ", ordered)
+		return
+	}
+
+	for i, k := range expected {
+		if ordered[i] != k {
+			t.Error("locks are not in key order: ", ordered)
+		}
+	}
+}
+
+func TestKeyLocksCleanUp (t *testing.T) {
+	kl := newKeyLocks()
+
+	kl.lock("b", "a")
+
+	if len(kl.locks) != 2 {
+		t.Error("there should be a lock for each key: ", len(kl.locks))
+	}
+
+	kl.unlock("a", "b")
+
+	if len(kl.locks) != 0 {
+		t.Error("locks nobody holds should be thrown away: ", len(kl.locks))
+	}
+}
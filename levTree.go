@@ -48,8 +48,8 @@ tree.go
 // database's tables and a forest's child trees as sub tables.
 /**/
 // Root - the bottom namespace of the database.  This Node is just a place to hold
-// Meta data about your forests.  Since you can't directly name your forests, you
-// can instead put identifying data in the root's child metadata Records.
+// Meta data about your forests.  Forests (like any other node) can be given names
+// when they're made, see names.go.
 /*
 dbFunnel.go
 */
@@ -68,40 +68,335 @@ dbFunnel.go
 // to the database itself and bypass the funnel so that reads and writes don't
 // have to compete for access.  When an update is called for an Node that is in
 // the funnel that update will be applied to that copy of the Node in the funnel.
+/**/
+// Deletes go through the funnel as well.  A deleted Node is replaced in the
+// funnel by a tombstone, which turns into a delete on the next write and stops
+// any later update from putting the Node back.
+/**/
+// If you do need to read your own writes, open the DB with ReadYourWrites set.
+// Reads will then lay whatever is waiting in the funnel over what they find on
+// the db (including nodes that aren't on the db yet), at the cost of competing
+// with updates for the funnel.
+/*
+tx.go
+*/
+// The tx module is the update interface.  An update locks the nodes it's given,
+// loads their most up to date copies, lets you change them and then puts the
+// changes in the funnel.  Update does all of that around a callback, so the
+// locks are always released no matter how the callback returns.  OpenUpdate and
+// CloseUpdate are the same thing split in two.
+/*
+wal.go
+*/
+// The wal module is an optional write ahead log for the funnel.  With it turned
+// on every node that goes into the funnel is first appended to a file next to
+// the leveldb directory, and anything left in that file by a crash is put back
+// into the funnel when the db is opened again.  The file is truncated each time
+// the funnel is written to the db.
+/*
+iterator.go
+*/
+// The iterator module reads nodes off of the db one at a time, so that big
+// buckets can be gone through without holding all of them in memory and the
+// read can be stopped part way through.  The Iter functions return Iterators
+// and the Get functions that return slices are built on them.
+/*
+names.go
+*/
+// The names module lets children be given names that they can be looked up by,
+// so that finding the child called "settings" doesn't mean reading every child.
+// Names are unique among a parent's children and are kept in an index that
+// scans of the db's nodes never see.
+/*
+ordered.go
+*/
+// The ordered module keeps a parent's children in whatever order they're put in.
+// An ordered child's id starts with a position that sorts between its neighbours,
+// so putting a child in or moving it around only changes that one child's id.
+/*
+ids.go
+*/
+// The ids module decides how the ids of new nodes are made.  The DB has a
+// generator that every forest uses unless it's been given its own, so forests
+// can choose whether their children come back in random order, the order they
+// were made in (UUIDv7 or a Counter kept on the db) or by their content.
+/*
+migrate.go
+*/
+// The migrate module moves a db's keys to the current version of the key
+// encoding when it's opened, a chunk at a time, and only marks the db as
+// migrated once every key's been moved, so a migration that's cut short carries
+// on the next time the db is opened.  A db with keys in a newer version than
+// this one knows about won't be opened.
 /*location.go*/
 // The Location module provides a bucketing system for namespacing keys.  id
-// generation defaults to guuid V4, which is sufficient for my usecase, but other
-// options may be added later.
+// generation defaults to guuid V4; other generators are in
+// keyChain/generators.go and ids.go.  Keys start with the version of their
+// encoding and every id in them is escaped and terminated, so no two locations
+// share a key and a bucket's key is only the start of what's in it.  Keys can
+// be read back with keyChain.ParseKey and keyChain.ParseKeyChain.  See
+// keyChain/encoding.go.  Locations and KeyChains can also be written as text
+// (and so as JSON) for URLs, logs and config files, see keyChain/text.go.
 package levTree
 
 import (
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
 	"github.com/AVickory/levTree/keyChain"
+	"github.com/syndtr/goleveldb/leveldb"
 )
 
-// Should be run (and finish running) before any other operations on the db.
-// Don't forget to register any types that you're storing using non-primitive
-// types with gob.
-
 // The only role of root record is to allow the look up of the root Node.
 var rootNode Node = Node{
 	KeyChain: keyChain.Root,
 }
 
-func InitDb(path string, writeInterval time.Duration) {
-	dbPath = path
+// A DB is a handle on a single levTree database.  Every DB owns its own funnel
+// and flushes it on its own schedule, so a process can have any number of them
+// open at once as long as they point at different paths.
+type DB struct {
+	//string of the filepath to leveldb
+	path string
+
+	//time between write batches.
+	waitBetweenWrites time.Duration
+
+	funnel funnel
+
+	//locks on the individual nodes being updated.
+	locks *keyLocks
+
+	//what makes the ids of new nodes.
+	ids idGenerators
+
+	//updates that were opened with OpenUpdate and haven't been closed.
+	openUpdates openUpdates
+
+	//whether reads should look in the funnel before going to the db.
+	readYourWrites bool
+
+	//nil unless the db was opened with a write ahead log.
+	wal *wal
+
+	//the single leveldb handle shared by reads and the funnel.  goleveldb is
+	//safe for concurrent use, so there's no reason to reopen it per operation.
+	ldb *leveldb.DB
+
+	//closing stop tells the funnel goroutine to exit.  It closes stopped once
+	//it has.
+	stop chan struct{}
+	stopped chan struct{}
+	closeOnce sync.Once
+
+	//set once Close has succeeded, so that closing again does nothing.
+	closeMutex sync.Mutex
+	closed bool
+}
+
+// Returned when trying to change the root node, which isn't stored.
+var ErrRootNode = errors.New("levTree: the root node can't be changed")
+
+// Returned when trying to move a node under itself or one of its descendants.
+var ErrMoveIntoSubtree = errors.New("levTree: can't move a node into its own subtree")
+
+// Options that can be set when opening a DB.  The zero value is usable.
+type Options struct {
+	// The time between write batches.  Defaults to one second.
+	WriteInterval time.Duration
+
+	// If set, reads will see updates that are still waiting in the funnel.
+	// See dbFunnel.go.
+	ReadYourWrites bool
+
+	// If set, everything that goes into the funnel is first logged to a file
+	// next to the db (at path + ".wal"), so that closed updates survive a
+	// crash.  See wal.go.
+	WriteAheadLog bool
+
+	// Makes the ids of new nodes.  Defaults to keyChain.UUIDv4.  Forests can
+	// be given their own with SetForestIdGenerator.  See ids.go.
+	IdGenerator keyChain.IdGenerator
+}
+
+// Opens (creating it if it doesn't exist) the database at path and starts its
+// funnel.  Don't forget to register any types that you're storing using
+// non-primitive types with gob.
+func Open(path string, opts Options) (*DB, error) {
+	db := &DB{
+		path: path,
+		waitBetweenWrites: opts.WriteInterval,
+		readYourWrites: opts.ReadYourWrites,
+		funnel: funnel{
+			nodes: make(map[string]Node),
+			deleted: make(map[string]Node),
+		},
+		locks: newKeyLocks(),
+		ids: idGenerators{
+			defaultGenerator: opts.IdGenerator,
+			forests: make(map[string]keyChain.IdGenerator),
+			counters: make(map[string]*Counter),
+		},
+		openUpdates: openUpdates{
+			txs: make(map[string]*Tx),
+		},
+		stop: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if db.waitBetweenWrites <= 0 {
+		db.waitBetweenWrites = defaultWaitBetweenWrites
+	}
+
+	if db.ids.defaultGenerator == nil {
+		db.ids.defaultGenerator = keyChain.UUIDv4{}
+	}
+
+	var err error
+	db.ldb, err = leveldb.OpenFile(path, nil)
+
+	if err != nil {
+		fmt.Println("error opening db: ", err)
+		return nil, err
+	}
+
+	err = db.migrateKeys()
+
+	if err != nil {
+		fmt.Println("error migrating keys: ", err)
+		db.ldb.Close()
+		return nil, err
+	}
+
+	if opts.WriteAheadLog {
+		err = db.recoverWal(path + walSuffix)
+
+		if err != nil {
+			fmt.Println("error recovering write ahead log: ", err)
+			db.ldb.Close()
+			return nil, err
+		}
+	}
+
+	go db.startFunnel()
+
+	return db, nil
+}
+
+//opens the write ahead log and writes anything that was left in it by a crash
+//to the db.
+func (db *DB) recoverWal(path string) error {
+	var err error
+	db.wal, err = openWal(path)
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := db.wal.replay()
+
+	if err != nil {
+		db.wal.close()
+		return err
+	}
+
+	//later entries replace earlier ones, same as they did in the funnel.
+	for _, e := range entries {
+		if e.deleted {
+			db.funnel.tombstone(e.node)
+		} else {
+			db.funnel.put(e.node)
+		}
+	}
+
+	err = db.clearFunnel()
+
+	if err != nil {
+		db.wal.close()
+		return err
+	}
+
+	//clearFunnel only truncates when there was something to write, but a log
+	//with nothing but a torn record in it still has to be emptied, or the next
+	//record would be read as the torn record's body.
+	err = db.wal.truncate()
+
+	if err != nil {
+		db.wal.close()
+		return err
+	}
+
+	return nil
+}
+
+// Synchronously writes everything currently in the funnel to disk.  Once it
+// returns without error, every update closed before the call is on the db.
+func (db *DB) Flush() error {
+	err := db.clearFunnel()
+
+	if err != nil {
+		fmt.Println("error flushing funnel: ", err)
+		return err
+	}
+
+	return nil
+}
+
+// Stops the funnel, writes anything left in it to disk and releases the leveldb
+// handle.  If the final write fails its error is returned and the handle is
+// left open so that nothing is lost; Flush and Close can then be retried.  The
+// DB can't be used after it has been closed, but closing it again returns nil.
+func (db *DB) Close() error {
+	db.closeMutex.Lock()
+	defer db.closeMutex.Unlock()
+
+	if db.closed {
+		return nil
+	}
+
+	db.closeOnce.Do(func() {
+		close(db.stop)
+	})
+
+	<-db.stopped
+
+	err := db.Flush()
+
+	if err != nil {
+		fmt.Println("error clearing funnel on close: ", err)
+		return err
+	}
+
+	if db.wal != nil {
+		err = db.wal.close()
 
-	waitBetweenWrites = writeInterval
+		if err != nil {
+			fmt.Println("error closing write ahead log: ", err)
+			return err
+		}
+
+		//so that a retry doesn't close it again.
+		db.wal = nil
+	}
+
+	err = db.ldb.Close()
+
+	if err != nil {
+		fmt.Println("error closing db: ", err)
+		return err
+	}
 
-	go startFunnel()
+	db.closed = true
 
+	return nil
 }
 
 // a forest is a tree attached to the root Node whose key is the namespace for
 // all of it's children.  Modifications to the returned forest cannot be
 // persisted.
-func NewForest(data []byte) (locateable, error) {
+func (db *DB) NewForest(data []byte) (locateable, error) {
 
 	newForest, err := makeForest(data)
 
@@ -110,7 +405,14 @@ func NewForest(data []byte) (locateable, error) {
 		return nil, err
 	}
 
-	err = createNode(newForest)
+	err = db.assignId(&newForest)
+
+	if err != nil {
+		fmt.Println("error making forest id: ", err)
+		return nil, err
+	}
+
+	err = db.createNode(newForest)
 
 	if err != nil {
 		fmt.Println("error putting forest in db: ", err)
@@ -124,7 +426,7 @@ func NewForest(data []byte) (locateable, error) {
 // Creates a child of the calling tree or forest in that tree's namespace, whose
 // key is the namespace for all of it's children.  Modifications to the returned
 // tree cannot be persisted.
-func NewTree(parent locateable, data []byte) (locateable, error) {
+func (db *DB) NewTree(parent locateable, data []byte) (locateable, error) {
 	newTree, err := makeTree(parent, data)
 
 	if err != nil {
@@ -132,7 +434,14 @@ func NewTree(parent locateable, data []byte) (locateable, error) {
 		return nil, err
 	}
 
-	err = createNode(newTree)
+	err = db.assignId(&newTree)
+
+	if err != nil {
+		fmt.Println("error making tree id: ", err)
+		return nil, err
+	}
+
+	err = db.createNode(newTree)
 
 	if err != nil {
 		fmt.Println("error putting tree in db: ", err)
@@ -147,7 +456,7 @@ func NewTree(parent locateable, data []byte) (locateable, error) {
 // the calling Node's children.  It doesn't return anything, because you won't
 // be able to access it on the db until the funnel flushes. Modifications to the
 // returned forest cannot be persisted.
-func NewBranch(parent locateable, data []byte) (locateable, error) {
+func (db *DB) NewBranch(parent locateable, data []byte) (locateable, error) {
 	newBranch, err := makeBranch(parent, data)
 
 	if err != nil {
@@ -155,7 +464,14 @@ func NewBranch(parent locateable, data []byte) (locateable, error) {
 		return nil, err
 	}
 
-	err = createNode(newBranch)
+	err = db.assignId(&newBranch)
+
+	if err != nil {
+		fmt.Println("error making branch id: ", err)
+		return nil, err
+	}
+
+	err = db.createNode(newBranch)
 
 	if err != nil {
 		fmt.Println("error putting branch in db: ", err)
@@ -166,13 +482,62 @@ func NewBranch(parent locateable, data []byte) (locateable, error) {
 	return newBranch.KeyChain, err
 }
 
-// func NewSiblingBranch(n locateable, data []byte) (keyChain.Loc, error) {
+// Makes and persists a branch with the same parent as n, so it will be in n's
+// sibling bucket.  n can be any Node or KeyChain, the parent doesn't need to
+// be looked up.  Modifications to the returned branch cannot be persisted.
+func (db *DB) NewSiblingBranch(n locateable, data []byte) (locateable, error) {
+	newBranch, err := makeSiblingBranch(n, data)
+
+	if err != nil {
+		fmt.Println("error making sibling branch Node: ", err)
+		return nil, err
+	}
+
+	err = db.assignId(&newBranch)
+
+	if err != nil {
+		fmt.Println("error making sibling branch id: ", err)
+		return nil, err
+	}
+
+	err = db.createNode(newBranch)
+
+	if err != nil {
+		fmt.Println("error putting sibling branch in db: ", err)
+		return nil, err
+	}
+
+	return newBranch.KeyChain, nil
+}
+
+// Makes and persists a tree with the same parent as n, so it will be in n's
+// sibling bucket.  n can be any Node or KeyChain, the parent doesn't need to
+// be looked up.  Fails with keyChain.ErrTreeUnderBranch if n's parent is a
+// branch.  Modifications to the returned tree cannot be persisted.
+func (db *DB) NewSiblingTree(n locateable, data []byte) (locateable, error) {
+	newTree, err := makeSiblingTree(n, data)
+
+	if err != nil {
+		fmt.Println("error making sibling tree Node: ", err)
+		return nil, err
+	}
+
+	err = db.assignId(&newTree)
+
+	if err != nil {
+		fmt.Println("error making sibling tree id: ", err)
+		return nil, err
+	}
 
-// }
+	err = db.createNode(newTree)
 
-// func NewSiblingTree(n locateable, data []byte) (keyChain.Loc, error) {
+	if err != nil {
+		fmt.Println("error putting sibling tree in db: ", err)
+		return nil, err
+	}
 
-// }
+	return newTree.KeyChain, nil
+}
 
 // Gets the Node which the locateable describes (for instance, if called on a
 // childmetaRecord, gets the actual child Node).
@@ -182,8 +547,8 @@ func NewBranch(parent locateable, data []byte) (locateable, error) {
 // bypass this behavior then you can pass in the Node's Record field instead of
 // the Node.  This workaround should be used sparingly so that you don't run
 // into consistency errors and avoid making more database queries than you need.
-func Get(kc locateable) (Node, error) {
-	n, err := getNode(kc.GetLoc())
+func (db *DB) Get(kc locateable) (Node, error) {
+	n, err := db.getNode(kc.GetLoc())
 	if err != nil {
 		fmt.Println("error getting location's node", err)
 		return n, err
@@ -194,8 +559,8 @@ func Get(kc locateable) (Node, error) {
 
 // Gets the calling Node's parent.  Modifications to the returned Node cannot be
 // persisted.
-func GetParent(child locateable) (Node, error) {
-	parent, err := getNode(child.GetParentLoc())
+func (db *DB) GetParent(child locateable) (Node, error) {
+	parent, err := db.getNode(child.GetParentLoc())
 
 	if err != nil {
 		fmt.Println("error getting parent Node", err)
@@ -205,11 +570,201 @@ func GetParent(child locateable) (Node, error) {
 	return parent, nil
 }
 
+// What Walk should do after visiting a node.
+type WalkAction int
+
+const (
+	// Go on to the node's children.
+	WalkContinue WalkAction = iota
+
+	// Leave out the node's descendants, but go on with the rest of the walk.
+	WalkSkipChildren
+
+	// End the walk without visiting anything else.
+	WalkStop
+)
+
+// Calls fn on the node at root and then on each of its descendants, depth
+// first, with each node's children in key order.  depth is how far below root
+// the node is, so root itself is at depth 0.  fn's WalkAction decides whether
+// the walk goes into the node's children, skips them or stops.  A tree's
+// subtree is read with a single prefix scan when the walk reaches it, and a
+// branch's children are read one branch at a time.  Modifications to the nodes
+// cannot be persisted.
+func (db *DB) Walk(root locateable, fn func(n Node, depth int) WalkAction) error {
+	n := rootNode
+
+	if !root.GetLoc().Equal(rootNode.GetLoc()) {
+		var err error
+		n, err = db.getNode(root.GetLoc())
+
+		if err != nil {
+			fmt.Println("error getting walk's root: ", err)
+			return err
+		}
+	}
+
+	_, err := db.walk(n, 0, fn)
+
+	if err != nil {
+		fmt.Println("error walking subtree: ", err)
+		return err
+	}
+
+	return nil
+}
+
+//visits n and then its descendants.  Returns true if the walk was stopped.
+func (db *DB) walk(n Node, depth int, fn func(n Node, depth int) WalkAction) (bool, error) {
+	switch fn(n, depth) {
+	case WalkStop:
+		return true, nil
+	case WalkSkipChildren:
+		return false, nil
+	}
+
+	if n.IsTree && !n.Equal(rootNode.KeyChain) {
+		s := &Subtree{Node: n}
+
+		err := db.fillTreeSubtree(s, 0)
+
+		if err != nil {
+			return false, err
+		}
+
+		for _, c := range s.Children {
+			if walkSubtree(c, depth + 1, fn) {
+				return true, nil
+			}
+		}
+
+		return false, nil
+	}
+
+	children, err := db.getImmediateChildren(n.GetChildBucket(), n.GetLoc())
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, c := range children {
+		stopped, err := db.walk(c, depth + 1, fn)
+
+		if stopped || err != nil {
+			return stopped, err
+		}
+	}
+
+	return false, nil
+}
+
+//visits a subtree that has already been read.  Returns true if the walk was
+//stopped.
+func walkSubtree(s *Subtree, depth int, fn func(n Node, depth int) WalkAction) bool {
+	switch fn(s.Node, depth) {
+	case WalkStop:
+		return true
+	case WalkSkipChildren:
+		return false
+	}
+
+	for _, c := range s.Children {
+		if walkSubtree(c, depth + 1, fn) {
+			return true
+		}
+	}
+
+	return false
+}
+
+//locates l's ancestors, nearest first, leaving out the root.  Branches have to
+//be read to find their parents, but once a tree is reached the rest are the
+//trees in its namespace, which don't need to be read.  The branches that were
+//read are returned by key.
+func (db *DB) locateAncestors(l locateable) ([]keyChain.Loc, map[string]Node, error) {
+	locs := make([]keyChain.Loc, 0, 4)
+	read := make(map[string]Node)
+
+	var current locateable = l
+
+	for !current.GetParentLoc().Equal(rootNode.GetLoc()) {
+		if current.ParentIsTree() {
+			locs = append(locs, current.GetTreeAncestors()...)
+			break
+		}
+
+		parent, err := db.getNode(current.GetParentLoc())
+
+		if err != nil {
+			fmt.Println("error getting ancestor: ", err)
+			return locs, read, err
+		}
+
+		locs = append(locs, parent.GetLoc())
+		read[parent.KeyString()] = parent
+		current = parent
+	}
+
+	return locs, read, nil
+}
+
+// Gets the calling Node's parent, its parent and so on up to its forest, in
+// that order.  Only branch ancestors have to be read one after another, tree
+// ancestors are located straight from the calling Node's namespace.
+// Modifications to the returned nodes cannot be persisted.
+func (db *DB) GetAncestors(l locateable) ([]Node, error) {
+	locs, read, err := db.locateAncestors(l)
+
+	if err != nil {
+		fmt.Println("error locating ancestors: ", err)
+		return nil, err
+	}
+
+	ancestors := make([]Node, len(locs))
+
+	for i, loc := range locs {
+		n, wasRead := read[loc.KeyString()]
+
+		if !wasRead {
+			n, err = db.getNode(loc)
+
+			if err != nil {
+				fmt.Println("error getting ancestor: ", err)
+				return ancestors[:i], err
+			}
+		}
+
+		ancestors[i] = n
+	}
+
+	return ancestors, nil
+}
+
+// Gets the locations of the calling Node's forest, the forest's child on the
+// way down and so on down to the calling Node itself, which is last.  Only
+// branch ancestors are read.
+func (db *DB) GetPath(l locateable) ([]keyChain.Loc, error) {
+	locs, _, err := db.locateAncestors(l)
+
+	if err != nil {
+		fmt.Println("error locating ancestors: ", err)
+		return nil, err
+	}
+
+	path := make([]keyChain.Loc, 0, len(locs) + 1)
+
+	for i := len(locs) - 1; i >= 0; i-- {
+		path = append(path, locs[i])
+	}
+
+	return append(path, l.GetLoc()), nil
+}
+
 // Gets all of the calling Node's children.  Generally it's better to use
 // the meta version And load a subset of children based on the meta data stored in
 // the Node.  Modifications to the returned nodes cannot be persisted.
-func GetChildren(parent locateable) ([]Node, error) {
-	children, err := getNodesFromBucket(parent.GetChildBucket())
+func (db *DB) GetChildren(parent locateable) ([]Node, error) {
+	children, err := db.getImmediateChildren(parent.GetChildBucket(), parent.GetLoc())
 
 	if err != nil {
 		fmt.Println("error getting children nodes: ", err)
@@ -220,80 +775,768 @@ func GetChildren(parent locateable) ([]Node, error) {
 
 }
 
-//only works for trees right now.  using it on branch's is not reccomended
-//since it requires a breadth first search and will be a lot slower.
-func GetDescendants(parent locateable) ([]Node, error) {
-	descendants, err := getNodesFromBucket(parent.GetDescendantBucket())
+// Returned when asking for a page of less than one node.
+var ErrPageLimit = errors.New("levTree: a page must have room for at least one node")
 
-	if err != nil {
-		fmt.Println("error getting descendants nodes: ", err)
-		return descendants, err
+// Marks where a page of nodes left off.  It's the key of the first node on the
+// next page, but it should be treated as opaque.  A nil Cursor is the start of
+// the first page, and is returned once there are no more pages.
+type Cursor []byte
+
+// Gets up to limit of the calling Node's children, starting at cursor, along
+// with the Cursor for the next page.  Each page seeks straight to its cursor,
+// so getting a page costs the same no matter how far in it is.  If children are
+// added or deleted between pages, each child is still returned at most once.
+// Modifications to the returned nodes cannot be persisted.
+func (db *DB) GetChildrenPage(parent locateable, cursor Cursor, limit int) ([]Node, Cursor, error) {
+	if limit < 1 {
+		fmt.Println("error getting page of children: ", ErrPageLimit)
+		return nil, cursor, ErrPageLimit
 	}
 
-	return descendants, err
-}
+	it := db.IterChildren(parent)
+	defer it.Release()
+
+	if cursor != nil {
+		it.seek(cursor)
+	}
+
+	children := make([]Node, 0, limit)
+
+	for it.Next() {
+		if len(children) == limit {
+			return children, Cursor(it.Node().Key()), nil
+		}
+
+		children = append(children, it.Node())
+	}
 
-func GetSiblings(l locateable) ([]Node, error) {
-	siblings, err := getNodesFromBucket(l.GetSiblingBucket())
+	err := it.Err()
 
 	if err != nil {
-		fmt.Println("error getting sibling nodes: ", err)
-		return siblings, err
+		fmt.Println("error getting page of children: ", err)
+		return children, nil, err
 	}
 
-	return siblings, nil
+	return children, nil, nil
 }
 
+// Gets all of the calling Node's descendants.  A tree's descendants are read
+// with a single prefix scan, but a branch's have to be read a level at a time
+// (see TraverseDescendants), which will be a lot slower.  Modifications to the
+// returned nodes cannot be persisted.
+func (db *DB) GetDescendants(parent locateable) ([]Node, error) {
+	if !isTree(parent) {
+		return db.TraverseDescendants(parent, TraversalOptions{})
+	}
 
-// Gets all forests in the db.
-// Modifications to the returned forests cannot be persisted.
-// DOES NOT CURRENTLY WORK.  Right now it loads all nodes in the
-//db.  the GetImmediateChildren function is next on the feature list
-//and will fix this
-func GetForests() ([]Node, error) {
-	forests, err := GetChildren(rootNode)
+	descendants, err := db.getNodesFromBucket(parent.GetDescendantBucket())
 
 	if err != nil {
-		fmt.Println("error getting forests: ", err)
-		return forests, err
+		fmt.Println("error getting descendants nodes: ", err)
+		return descendants, err
 	}
 
-	return forests, nil
+	return descendants, err
 }
 
-// Returns the most up-to-date version of the node at the locations ls indicates.
-// These nodes can be updated, but must be passed into Close Update for thos
-// updates to take place (or for any updates to ever take place again).  It is
-// intended for updates only.  If you want to do insertions use the new
-// functions and if you only need to read, then use the get functions.
-// note that changing the child and parent meta data on one node does not
-// automatically change the corresponding data on the parent or child node.
-// DO NOT MODIFY LOCATIONS.  if you do, you may end up with duplicates on the
-// db.
-// Eventually I'll set it up to only lock individual nodes and only put a read
-// lock on the funnel, but for now this sets up the api and general
-// functionality.
-func OpenUpdate(kcs ...locateable) ([]Node, error) {
-	funnel.mutex.Lock()
-
-	updateableNodes := make([]Node, len(kcs))
-
-	for i, kc := range kcs {
-		updateableNode, err := getNodeUpdateable(kc.GetLoc())
+// Gets the node at l with its descendants down to maxDepth levels below it
+// attached, so 1 only gets its children.  A maxDepth of 0 means there's no
+// limit.  A tree's descendants are read with a single prefix scan that stops as
+// soon as the heights in the keys show everything left is too deep, and a
+// branch's are read a level at a time.  Modifications to the returned nodes
+// cannot be persisted.
+func (db *DB) GetSubtree(l locateable, maxDepth int) (*Subtree, error) {
+	n := rootNode
+
+	if !l.GetLoc().Equal(rootNode.GetLoc()) {
+		var err error
+		n, err = db.getNode(l.GetLoc())
+
 		if err != nil {
-			fmt.Println("error getting updateable Node", err)
-			return updateableNodes, err
+			fmt.Println("error getting subtree's root: ", err)
+			return nil, err
 		}
-		updateableNodes[i] = updateableNode
 	}
 
-	return updateableNodes, nil
+	var maxHeight uint64
+
+	if maxDepth > 0 {
+		maxHeight = n.Id.Height + uint64(maxDepth)
+	}
+
+	s := &Subtree{Node: n}
+
+	err := db.fillSubtree(s, maxHeight)
+
+	if err != nil {
+		fmt.Println("error getting subtree: ", err)
+		return s, err
+	}
+
+	return s, nil
+}
+
+//attaches the descendants of s that aren't below maxHeight, or all of them if
+//it's 0.
+func (db *DB) fillSubtree(s *Subtree, maxHeight uint64) error {
+	if maxHeight != 0 && s.Id.Height >= maxHeight {
+		return nil
+	}
+
+	//the root's descendant bucket is the whole db, so it's better off
+	//skipping from forest to forest.
+	if s.IsTree && !s.Equal(rootNode.KeyChain) {
+		return db.fillTreeSubtree(s, maxHeight)
+	}
+
+	children, err := db.getImmediateChildren(s.GetChildBucket(), s.GetLoc())
+
+	if err != nil {
+		fmt.Println("error getting children: ", err)
+		return err
+	}
+
+	for _, c := range children {
+		child := &Subtree{Node: c}
+
+		err = db.fillSubtree(child, maxHeight)
+
+		if err != nil {
+			return err
+		}
+
+		s.Children = append(s.Children, child)
+	}
+
+	return nil
+}
+
+//fills in a tree's subtree from a single scan of its descendant bucket.  After
+//the bucket's prefix, every key starts with the id of the node's parent or of a
+//tree above it, and keys are ordered by that id's height first.  So once that
+//height reaches maxHeight every node left is deeper still and the scan stops.
+func (db *DB) fillTreeSubtree(s *Subtree, maxHeight uint64) error {
+	prefixLength := len(s.GetDescendantBucket().Key())
+
+	it := db.newBucketIterator(s.GetDescendantBucket(), db.readYourWrites)
+	defer it.Release()
+
+	nodes := make([]Node, 0, 10)
+
+	for it.Next() {
+		n := it.Node()
+
+		if maxHeight != 0 {
+			h, ok := keyChain.FirstHeight(n.Key()[prefixLength:])
+
+			if ok && h >= maxHeight {
+				break
+			}
+
+			if n.Id.Height > maxHeight {
+				continue
+			}
+		}
+
+		//the root's descendant bucket includes the root.
+		if !n.Equal(s.KeyChain) {
+			nodes = append(nodes, n)
+		}
+	}
+
+	err := it.Err()
+
+	if err != nil {
+		fmt.Println("error scanning tree: ", err)
+		return err
+	}
+
+	//parents have to be attached before their children.
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Id.Height < nodes[j].Id.Height
+	})
+
+	subtrees := map[string]*Subtree{s.KeyString(): s}
+
+	for _, n := range nodes {
+		parent, found := subtrees[n.GetParentLoc().KeyString()]
+
+		//the parent was deleted without its children.
+		if !found {
+			continue
+		}
+
+		child := &Subtree{Node: n}
+		parent.Children = append(parent.Children, child)
+		subtrees[n.KeyString()] = child
+	}
+
+	return nil
+}
+
+// The order that a traversal returns nodes in.
+type Order int
+
+const (
+	// Every node at one depth before any at the next.
+	BreadthFirst Order = iota
+
+	// Every node right before its own descendants.
+	DepthFirst
+)
+
+// Options for TraverseDescendants.  The zero value gets every descendant,
+// breadth first.
+type TraversalOptions struct {
+	// How many levels below the node to go, so 1 only gets its children.  0
+	// means there's no limit.
+	MaxDepth int
+
+	Order Order
+}
+
+// Gets the calling Node's descendants by reading its children, then their
+// children and so on, which works for branches as well as trees.  Children are
+// returned in key order.  Modifications to the returned nodes cannot be
+// persisted.
+func (db *DB) TraverseDescendants(parent locateable, opts TraversalOptions) ([]Node, error) {
+	type visit struct {
+		node locateable
+		depth int
+	}
+
+	descendants := make([]Node, 0, 10)
+	toVisit := []visit{{parent, 0}}
+
+	for len(toVisit) != 0 {
+		var current visit
+
+		if opts.Order == DepthFirst {
+			current = toVisit[len(toVisit) - 1]
+			toVisit = toVisit[:len(toVisit) - 1]
+		} else {
+			current = toVisit[0]
+			toVisit = toVisit[1:]
+		}
+
+		if current.depth != 0 {
+			descendants = append(descendants, current.node.(Node))
+		}
+
+		if opts.MaxDepth != 0 && current.depth >= opts.MaxDepth {
+			continue
+		}
+
+		children, err := db.getImmediateChildren(current.node.GetChildBucket(), current.node.GetLoc())
+
+		if err != nil {
+			fmt.Println("error getting descendant's children: ", err)
+			return descendants, err
+		}
+
+		if opts.Order == DepthFirst {
+			//pushed backwards so that the first child is visited first.
+			for i := len(children) - 1; i >= 0; i-- {
+				toVisit = append(toVisit, visit{children[i], current.depth + 1})
+			}
+		} else {
+			for _, c := range children {
+				toVisit = append(toVisit, visit{c, current.depth + 1})
+			}
+		}
+	}
+
+	return descendants, nil
+}
+
+//gets the node at l and all of its descendants, always reading through the
+//funnel.  Trees' descendants are read with a single prefix scan, branches'
+//are read a level at a time.
+func (db *DB) collectSubtree(l locateable) ([]Node, error) {
+	n, err := db.getNodeUpdateable(l.GetLoc())
+
+	if err != nil {
+		fmt.Println("error getting subtree's root: ", err)
+		return nil, err
+	}
+
+	subtree := []Node{n}
+
+	//nodes whose descendants haven't been read yet.
+	toScan := []Node{n}
+
+	for len(toScan) != 0 {
+		current := toScan[0]
+		toScan = toScan[1:]
+
+		if current.IsTree {
+			descendants, err := db.scanBucket(current.GetDescendantBucket(), true)
+
+			if err != nil {
+				fmt.Println("error getting tree's descendants: ", err)
+				return subtree, err
+			}
+
+			for _, d := range descendants {
+				//the root's descendant bucket includes the root.
+				if !d.Equal(current.KeyChain) {
+					subtree = append(subtree, d)
+				}
+			}
+		} else {
+			children, err := db.scanBucket(current.GetChildBucket(), true)
+
+			if err != nil {
+				fmt.Println("error getting branch's children: ", err)
+				return subtree, err
+			}
+
+			for _, c := range children {
+				//a branch attached to the root has its children's
+				//bucket as its key.
+				if !c.Equal(current.KeyChain) {
+					subtree = append(subtree, c)
+					toScan = append(toScan, c)
+				}
+			}
+		}
+	}
+
+	return subtree, nil
+}
+
+//whether a and b hold the nodes at the same locations.
+func sameLocs(a, b []Node) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	keys := make(map[string]bool, len(a))
+
+	for _, n := range a {
+		keys[n.KeyString()] = true
+	}
+
+	for _, n := range b {
+		if !keys[n.KeyString()] {
+			return false
+		}
+	}
+
+	return true
+}
+
+//collects the subtree at l and begins an update on it and extra.  Children are
+//made with their parents locked, so once the subtree's locked nothing can be
+//added to it, but something could have been between collecting it and locking
+//it.  So it's collected again once it's locked, and if it's changed the locks
+//are let go and it's tried again.
+func (db *DB) beginSubtree(l locateable, extra ...locateable) ([]Node, *Tx, error) {
+	subtree, err := db.collectSubtree(l)
+
+	if err != nil {
+		fmt.Println("error getting subtree: ", err)
+		return nil, nil, err
+	}
+
+	for {
+		locs := make([]locateable, 0, len(subtree) + len(extra))
+
+		for _, n := range subtree {
+			locs = append(locs, n)
+		}
+
+		locs = append(locs, extra...)
+
+		tx, err := db.begin(locs...)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		locked, err := db.collectSubtree(l)
+
+		if err == nil && sameLocs(subtree, locked) {
+			return subtree, tx, nil
+		}
+
+		tx.release()
+
+		if err != nil {
+			fmt.Println("error getting subtree: ", err)
+			return nil, nil, err
+		}
+
+		subtree = locked
+	}
+}
+
+// Deletes the node at l.  Only the node itself is deleted, use DeleteSubtree to
+// delete its descendants as well.  Like updates, deletes go through the funnel,
+// so unless the db reads its own writes the node can still be read until the
+// funnel is flushed, but it can't be updated.
+func (db *DB) Delete(l locateable) error {
+	if l.GetLoc().Equal(rootNode.GetLoc()) {
+		fmt.Println("error deleting node: ", ErrRootNode)
+		return ErrRootNode
+	}
+
+	return db.Update(func(tx *Tx) error {
+		return tx.Delete(l)
+	}, l)
+}
+
+// Deletes the node at l and all of its descendants.  The deletes are all put in
+// the funnel at once, so they'll be written in the same batch.  A child being
+// made under the subtree at the same time is either deleted along with it or
+// fails with ErrNotFound, since new nodes need their parents to be there.
+func (db *DB) DeleteSubtree(l locateable) error {
+	if l.GetLoc().Equal(rootNode.GetLoc()) {
+		fmt.Println("error deleting subtree: ", ErrRootNode)
+		return ErrRootNode
+	}
+
+	subtree, tx, err := db.beginSubtree(l)
+
+	if err != nil {
+		fmt.Println("error locking subtree: ", err)
+		return err
+	}
+
+	defer tx.release()
+
+	for _, n := range subtree {
+		err := tx.Delete(n)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.commit()
+}
+
+// Moves the node at n, along with all of its descendants, to be a child of
+// newParent and returns its new location.  Since a node's key is made from its
+// ancestors every node in the subtree gets a new KeyChain (keeping its
+// identifier), laid out by whether its new parent is a tree or a branch.  The
+// nodes are locked while they're moved, and the new nodes, the deletes of the
+// old ones and their names are written along with the funnel in a single
+// batch.  A child being made under the subtree at the same time either moves
+// with it or fails with ErrNotFound.  Names move with their nodes, so a named
+// node can still be found under its new parent; if the name is already taken
+// there the move fails with ErrNameTaken.  Locations read before the move are
+// no good afterwards.  Fails with keyChain.ErrTreeUnderBranch if a tree would
+// end up under a branch.
+func (db *DB) Move(n, newParent locateable) (keyChain.KeyChain, error) {
+	return db.moveSubtree(n, newParent, nil)
+}
+
+//moves n and its descendants under newParent.  If identifier isn't nil n is
+//given it in place of its own, which is how a node is moved among its
+//siblings.
+func (db *DB) moveSubtree(n, newParent locateable, identifier []byte) (keyChain.KeyChain, error) {
+	if n.GetLoc().Equal(rootNode.GetLoc()) {
+		fmt.Println("error moving node: ", ErrRootNode)
+		return keyChain.KeyChain{}, ErrRootNode
+	}
+
+	//the parent is locked too, so that it can't be deleted out from under
+	//the move.
+	parentIsRoot := newParent.GetLoc().Equal(rootNode.GetLoc())
+	extra := make([]locateable, 0, 1)
+
+	if !parentIsRoot {
+		extra = append(extra, newParent)
+	}
+
+	subtree, tx, err := db.beginSubtree(n, extra...)
+
+	if err != nil {
+		fmt.Println("error locking subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	defer tx.release()
+
+	for _, s := range subtree {
+		if s.GetLoc().Equal(newParent.GetLoc()) {
+			fmt.Println("error moving node: ", ErrMoveIntoSubtree)
+			return keyChain.KeyChain{}, ErrMoveIntoSubtree
+		}
+	}
+
+	parent := rootNode
+
+	if !parentIsRoot {
+		parent = tx.nodes[newParent.GetLoc().KeyString()]
+	}
+
+	//already there, nothing to move.
+	if identifier == nil && subtree[0].GetParentLoc().Equal(parent.GetLoc()) {
+		return subtree[0].KeyChain, nil
+	}
+
+	//parents have to be moved before their children.
+	sort.SliceStable(subtree, func(i, j int) bool {
+		return subtree[i].Id.Height < subtree[j].Id.Height
+	})
+
+	//the new keychains by old key.
+	moved := make(map[string]keyChain.KeyChain, len(subtree))
+	movedNodes := make([]Node, 0, len(subtree))
+	oldNodes := make([]Node, 0, len(subtree))
+
+	for i, s := range subtree {
+		old := tx.nodes[s.KeyString()]
+
+		newKc := parent.Adopt(old.KeyChain)
+
+		if i != 0 {
+			movedParent, found := moved[old.GetParentLoc().KeyString()]
+
+			//the parent was deleted without its children, so this one isn't
+			//part of the subtree any more and is left where it is.
+			if !found {
+				continue
+			}
+
+			newKc = movedParent.Adopt(old.KeyChain)
+		} else if identifier != nil {
+			newKc.Identifier = identifier
+		}
+
+		//trees can't be the descendants of branches (rule 1).
+		if old.IsTree && !parent.IsTree {
+			fmt.Println("error moving node: ", keyChain.ErrTreeUnderBranch)
+			return keyChain.KeyChain{}, keyChain.ErrTreeUnderBranch
+		}
+
+		moved[old.KeyString()] = newKc
+
+		movedNodes = append(movedNodes, Node{
+			KeyChain: newKc,
+			Data: old.Data,
+			Version: old.Version + 1,
+			//a node given a new identifier is being put in order.
+			Ordered: old.Ordered || (i == 0 && identifier != nil),
+		})
+		oldNodes = append(oldNodes, old)
+	}
+
+	batch := new(leveldb.Batch)
+
+	err = putNodes(batch, movedNodes...)
+
+	if err != nil {
+		fmt.Println("error moving subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	for _, old := range oldNodes {
+		batch.Delete(old.Key())
+	}
+
+	nameLocks, err := db.moveNames(batch, parent, oldNodes, movedNodes)
+
+	for _, key := range nameLocks {
+		defer db.locks.unlock(key)
+	}
+
+	if err != nil {
+		fmt.Println("error moving names: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	db.funnel.mutex.Lock()
+	defer db.funnel.mutex.Unlock()
+
+	//the rest of the subtree goes under the top, so only the top can land
+	//on a node that's already there.
+	_, err = db.checkFree(movedNodes[0])
+
+	if err != nil {
+		fmt.Println("error moving subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	err = db.writeFunnelWith(batch)
+
+	if err != nil {
+		fmt.Println("error moving subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	return movedNodes[0].KeyChain, nil
+}
+
+// Copies the node at src and all of its descendants to be a child of dstParent
+// and returns the copy's location.  The copies get new ids but keep their Data
+// and whether they're trees or branches, so the copy has the same shape as the
+// original.  Ordered copies (see ordered.go) get ids at their originals'
+// positions, so they stay in the same order.  dstParent can be in another
+// forest, or even in src's subtree.  The copies are written straight to the db
+// in a single batch, so either all of them can be read or none of them can.
+// The copies get the names of their originals, apart from the copy of src
+// itself when a child of dstParent already has src's name.  Fails with
+// keyChain.ErrTreeUnderBranch if src is a tree and dstParent is a branch.
+func (db *DB) CopySubtree(src, dstParent locateable) (keyChain.KeyChain, error) {
+	if src.GetLoc().Equal(rootNode.GetLoc()) {
+		fmt.Println("error copying subtree: ", ErrRootNode)
+		return keyChain.KeyChain{}, ErrRootNode
+	}
+
+	subtree, err := db.collectSubtree(src)
+
+	if err != nil {
+		fmt.Println("error getting subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	//parents have to be copied before their children.
+	sort.SliceStable(subtree, func(i, j int) bool {
+		return subtree[i].Id.Height < subtree[j].Id.Height
+	})
+
+	//trees can't be the descendants of branches (rule 1).  Only the top can
+	//be a tree going under a branch, since everything under a branch in the
+	//original is a branch too.
+	if subtree[0].IsTree && !dstParent.GetLoc().Equal(rootNode.GetLoc()) {
+		parentNode, err := db.Get(dstParent)
+
+		if err != nil {
+			fmt.Println("error getting copy's parent: ", err)
+			return keyChain.KeyChain{}, err
+		}
+
+		if !parentNode.IsTree {
+			fmt.Println("error copying subtree: ", keyChain.ErrTreeUnderBranch)
+			return keyChain.KeyChain{}, keyChain.ErrTreeUnderBranch
+		}
+	}
+
+	//the copies' keychains by the original's key.
+	copied := make(map[string]keyChain.KeyChain, len(subtree))
+	copies := make([]Node, 0, len(subtree))
+	originals := make([]Node, 0, len(subtree))
+
+	for i, n := range subtree {
+		var parent locateable = dstParent
+
+		if i != 0 {
+			copiedParent, found := copied[n.GetParentLoc().KeyString()]
+
+			//the parent was deleted without its children, so this one isn't
+			//part of the subtree any more.
+			if !found {
+				continue
+			}
+
+			parent = copiedParent
+		}
+
+		var newKc keyChain.KeyChain
+
+		if n.IsTree {
+			newKc, err = parent.MakeChildTree()
+		} else {
+			newKc, err = parent.MakeChildBranch()
+		}
+
+		if err != nil {
+			fmt.Println("error making copy's location: ", err)
+			return keyChain.KeyChain{}, err
+		}
+
+		c := Node{
+			KeyChain: newKc,
+			Data: n.Data,
+		}
+
+		//ordered copies keep their originals' positions, so the copy's
+		//children come off of the db in the same order.
+		if n.Ordered {
+			c.Id, err = keyChain.MakePositionId(c.Id.Height, n.Position())
+			c.Ordered = true
+		} else {
+			err = db.assignId(&c)
+		}
+
+		if err != nil {
+			fmt.Println("error making copy's id: ", err)
+			return keyChain.KeyChain{}, err
+		}
+
+		copied[n.KeyString()] = c.KeyChain
+		copies = append(copies, c)
+		originals = append(originals, n)
+	}
+
+	batch := new(leveldb.Batch)
+
+	err = putNodes(batch, copies...)
+
+	if err != nil {
+		fmt.Println("error writing copied subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	//every copy is locked, the same as createNode, since a branch's children
+	//aren't under its key.  Nodes are locked before names, the same as Move.
+	locks := createLocks(copies[0])
+
+	for _, c := range copies[1:] {
+		locks = append(locks, c.KeyString())
+	}
+
+	db.locks.lock(locks...)
+	defer db.locks.unlock(locks...)
+
+	nameLocks, err := db.copyNames(batch, dstParent, originals, copies)
+
+	for _, key := range nameLocks {
+		defer db.locks.unlock(key)
+	}
+
+	if err != nil {
+		fmt.Println("error copying names: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	err = db.createWith(batch, copies...)
+
+	if err != nil {
+		fmt.Println("error writing copied subtree: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	return copies[0].KeyChain, nil
 }
 
-func CloseUpdate(updatedNodes ...Node) {
-	for _, n := range updatedNodes {
-		funnel.nodes[n.KeyString()] = n
+// Gets all of the children of l's parent, including l.
+func (db *DB) GetSiblings(l locateable) ([]Node, error) {
+	siblings, err := db.getImmediateChildren(l.GetSiblingBucket(), l.GetParentLoc())
+
+	if err != nil {
+		fmt.Println("error getting sibling nodes: ", err)
+		return siblings, err
 	}
 
-	funnel.mutex.Unlock()
+	return siblings, nil
+}
+
+
+// Gets all forests in the db.  Only the forests themselves are read, the rest
+// of the db is skipped over.
+// Modifications to the returned forests cannot be persisted.
+func (db *DB) GetForests() ([]Node, error) {
+	forests, err := db.GetChildren(rootNode)
+
+	if err != nil {
+		fmt.Println("error getting forests: ", err)
+		return forests, err
+	}
+
+	return forests, nil
 }
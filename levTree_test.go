@@ -3,9 +3,10 @@ package levTree
 import (
 	"fmt"
 	"testing"
+	"sync"
 	"time"
 	"bytes"
-	// "github.com/AVickory/levTree/keyChain"
+	"github.com/AVickory/levTree/keyChain"
 )
 
 var dbm bool = false
@@ -16,14 +17,14 @@ func debug(stuff ...interface{}) {
 	}
 }
 
-func nodeTest(t *testing.T, data []byte, kc locateable) Node {
-	err := clearFunnel()
+func nodeTest(t *testing.T, db *DB, data []byte, kc locateable) Node {
+	err := db.clearFunnel()
 
 	if err != nil {
 		t.Error("error clearing funnel: ", err)
 	}
 
-	n, err := Get(kc)
+	n, err := db.Get(kc)
 
 	if err != nil {
 		t.Error("error getting node from db: ", err)
@@ -44,67 +45,67 @@ func nodeTest(t *testing.T, data []byte, kc locateable) Node {
 	return n
 }
 
-func forestTest (t *testing.T, data []byte) Node {
-	forestKc, err := NewForest(data)
+func forestTest (t *testing.T, db *DB, data []byte) Node {
+	forestKc, err := db.NewForest(data)
 
 	if err != nil {
 		t.Error("error making new forest: ", err)
 	}
 
-	return nodeTest(t, data, forestKc)
+	return nodeTest(t, db, data, forestKc)
 }
 
-func treeTest (t *testing.T, parent Node, data []byte) Node {
-	treeKc, err := NewTree(parent, data)
+func treeTest (t *testing.T, db *DB, parent Node, data []byte) Node {
+	treeKc, err := db.NewTree(parent, data)
 
 	if err != nil {
 		t.Error("error making new tree: ", err)
 	}
 
-	return nodeTest(t, data, treeKc)
+	return nodeTest(t, db, data, treeKc)
 }
 
-func branchTest (t *testing.T, parent Node, data []byte) Node {
-	branchKc, err := NewBranch(parent, data)
+func branchTest (t *testing.T, db *DB, parent Node, data []byte) Node {
+	branchKc, err := db.NewBranch(parent, data)
 
 	if err != nil {
 		t.Error("error making new branch: ", err)
 	}
 
-	return nodeTest(t, data, branchKc)
+	return nodeTest(t, db, data, branchKc)
 }
 
 func TestNew (t *testing.T) {
-	err := initForSynchronousTests()
+	db, err := initForSynchronousTests(t)
 
 	if err != nil {
 		t.Error("error initializing db: ", err)
 	}
 
-	f0 := forestTest(t, []byte{0})
+	f0 := forestTest(t, db, []byte{0})
 
-	_ = forestTest(t, []byte{1})
+	_ = forestTest(t, db, []byte{1})
 
-	t0 := treeTest(t, f0, []byte{2})
+	t0 := treeTest(t, db, f0, []byte{2})
 
-	_ = treeTest(t, f0, []byte{3})
+	_ = treeTest(t, db, f0, []byte{3})
 
-	b0 := branchTest(t, f0, []byte{4})
+	b0 := branchTest(t, db, f0, []byte{4})
 
-	_ = branchTest(t, f0, []byte{5})
+	_ = branchTest(t, db, f0, []byte{5})
 
-	_ = branchTest(t, t0, []byte{6})
+	_ = branchTest(t, db, t0, []byte{6})
 
-	_ = branchTest(t, t0, []byte{7})
+	_ = branchTest(t, db, t0, []byte{7})
 
-	_ = branchTest(t, b0, []byte{8})
+	_ = branchTest(t, db, b0, []byte{8})
 
-	_ = branchTest(t, b0, []byte{9})
+	_ = branchTest(t, db, b0, []byte{9})
 
 }
 
-func getParentTest (t *testing.T, parent Node, child Node) {
-	foundParent, err := GetParent(child)
+func getParentTest (t *testing.T, db *DB, parent Node, child Node) {
+	foundParent, err := db.GetParent(child)
 
 	if err != nil {
 		t.Error("error getting parent: ", err)
@@ -131,8 +132,8 @@ func rangeSearchTest(t *testing.T, parent Node, nodes []Node, numExpected int) {
 	}
 }
 
-func getChildrenTest (t *testing.T, parent Node, numChildren int) {
-	children, err := GetChildren(parent)
+func getChildrenTest (t *testing.T, db *DB, parent Node, numChildren int) {
+	children, err := db.GetChildren(parent)
 
 	if err != nil {
 		t.Error("error getting children: ", err)
@@ -141,8 +142,8 @@ func getChildrenTest (t *testing.T, parent Node, numChildren int) {
 	rangeSearchTest(t, parent, children, numChildren)
 }
 
-func getSiblingsTest (t *testing.T, n Node, numSiblings int) {
-	siblings, err := GetSiblings(n)
+func getSiblingsTest (t *testing.T, db *DB, n Node, numSiblings int) {
+	siblings, err := db.GetSiblings(n)
 
 	if err != nil {
 		t.Error("error getting siblings: ", err)
@@ -151,8 +152,8 @@ func getSiblingsTest (t *testing.T, n Node, numSiblings int) {
 	rangeSearchTest(t, n, siblings, numSiblings)
 }
 
-func getForestsTest(t *testing.T, numForests int) {
-	forests, err := GetForests()
+func getForestsTest(t *testing.T, db *DB, numForests int) {
+	forests, err := db.GetForests()
 
 	if err != nil {
 		t.Error("error getting forests: ", err)
@@ -161,121 +162,102 @@ func getForestsTest(t *testing.T, numForests int) {
 	rangeSearchTest(t, rootNode, forests, numForests)
 }
 
-//This test will fail until I get the immediate children search set up
 func TestGet (t *testing.T) {
-	err := initForSynchronousTests()
+	db, err := initForSynchronousTests(t)
 
 	if err != nil {
 		t.Error("error initializing db: ", err)
 	}
 
-	f0 := forestTest(t, []byte{0})
+	f0 := forestTest(t, db, []byte{0})
 
-	_ = forestTest(t, []byte{1})
+	_ = forestTest(t, db, []byte{1})
 
-	t0 := treeTest(t, f0, []byte{2})
+	t0 := treeTest(t, db, f0, []byte{2})
 
-	_ = treeTest(t, f0, []byte{3})
+	_ = treeTest(t, db, f0, []byte{3})
 
-	b0 := branchTest(t, f0, []byte{4})
+	b0 := branchTest(t, db, f0, []byte{4})
 
-	_ = branchTest(t, f0, []byte{5})
+	_ = branchTest(t, db, f0, []byte{5})
 
-	_ = branchTest(t, t0, []byte{6})
+	_ = branchTest(t, db, t0, []byte{6})
 
-	_ = branchTest(t, t0, []byte{7})
+	_ = branchTest(t, db, t0, []byte{7})
 
-	b1 := branchTest(t, b0, []byte{8})
+	b1 := branchTest(t, db, b0, []byte{8})
 
-	_ = branchTest(t, b0, []byte{9})
+	_ = branchTest(t, db, b0, []byte{9})
 
-	b2 := branchTest(t, b1, []byte{8})
+	b2 := branchTest(t, db, b1, []byte{8})
 
-	_ = branchTest(t, b1, []byte{9})
+	_ = branchTest(t, db, b1, []byte{9})
 
-	getParentTest(t, f0, t0)
+	getParentTest(t, db, f0, t0)
 
-	getParentTest(t, f0, b0)
+	getParentTest(t, db, f0, b0)
 
-	getParentTest(t, b0, b1)
+	getParentTest(t, db, b0, b1)
 
-	getParentTest(t, b1, b2)
+	getParentTest(t, db, b1, b2)
 
-	//trees may be one to high after keyChain update
-	dbm = true
-	i:= 0
-	t.Error(i)
-	i++
-	fmt.Println(rootNode)
-	getChildrenTest(t, rootNode, 12) //all nodes have 
-	t.Error(i)
-	i++
-	getChildrenTest(t, f0, 4) //4 immediate
-	t.Error(i)
-	i++
-	getChildrenTest(t, t0, 2) //2 immediate
-	t.Error(i)
-	i++
-	getChildrenTest(t, b0, 2) //2 immediate
-	t.Error(i)
-	i++
-	getChildrenTest(t, b1, 2) //2 immediate
-	t.Error(i)
-	i++
-	getChildrenTest(t, b2, 0) //no immediate
-	t.Error(i)
-	i++
+	getChildrenTest(t, db, rootNode, 2) //just the forests
+	getChildrenTest(t, db, f0, 4) //4 immediate
+	getChildrenTest(t, db, t0, 2) //2 immediate
+	getChildrenTest(t, db, b0, 2) //2 immediate
+	getChildrenTest(t, db, b1, 2) //2 immediate
+	getChildrenTest(t, db, b2, 0) //no immediate
 
-	getSiblingsTest(t, f0, 1) // this really should be 1
+	getSiblingsTest(t, db, f0, 2) // self and the other forest
 
-	getSiblingsTest(t, t0, 4) // should be 4.  finds parent if parent is tree and finds descendants of all siblings
+	getSiblingsTest(t, db, t0, 4) // should be 4.  finds parent if parent is tree and finds descendants of all siblings
 
-	getSiblingsTest(t, b0, 4) // should be 4.  
+	getSiblingsTest(t, db, b0, 4) // should be 4.  
 
-	getSiblingsTest(t, b1, 2) // self and sibling
+	getSiblingsTest(t, db, b1, 2) // self and sibling
 
-	getSiblingsTest(t, b2, 2) // self and sibling
+	getSiblingsTest(t, db, b2, 2) // self and sibling
 
 
-	getForestsTest(t, 12)
+	getForestsTest(t, db, 2)
 
 }
 
 func TestUpdate (t *testing.T) {
-	err := initForSynchronousTests()
+	db, err := initForSynchronousTests(t)
 
 	if err != nil {
 		t.Error("error initializing db: ", err)
 	}
 
-	f0 := forestTest(t, []byte{0})
+	f0 := forestTest(t, db, []byte{0})
 
-	_ = forestTest(t, []byte{1})
+	_ = forestTest(t, db, []byte{1})
 
-	t0 := treeTest(t, f0, []byte{2})
+	t0 := treeTest(t, db, f0, []byte{2})
 
-	_ = treeTest(t, f0, []byte{3})
+	_ = treeTest(t, db, f0, []byte{3})
 
-	_ = branchTest(t, f0, []byte{4}) //this used to be b0
+	_ = branchTest(t, db, f0, []byte{4}) //this used to be b0
 
-	_ = branchTest(t, f0, []byte{5})
+	_ = branchTest(t, db, f0, []byte{5})
 
-	b0 := branchTest(t, t0, []byte{6}) //now this one is b0.  this is to ensure consistent ordering.
+	b0 := branchTest(t, db, t0, []byte{6}) //now this one is b0.  this is to ensure consistent ordering.
 
-	_ = branchTest(t, t0, []byte{7})
+	_ = branchTest(t, db, t0, []byte{7})
 
-	b1 := branchTest(t, b0, []byte{8})
+	b1 := branchTest(t, db, b0, []byte{8})
 
-	_ = branchTest(t, b0, []byte{9})
+	_ = branchTest(t, db, b0, []byte{9})
 
-	b2 := branchTest(t, b1, []byte{8})
+	b2 := branchTest(t, db, b1, []byte{8})
 
-	_ = branchTest(t, b1, []byte{9})
+	_ = branchTest(t, db, b1, []byte{9})
 
 
 	initialNodes := []locateable{f0, t0, b0, b1, b2}
 
-	nodesToUpdate, err := OpenUpdate(initialNodes...)
+	nodesToUpdate, err := db.OpenUpdate(initialNodes...)
 
 	if err != nil {
 		t.Error("error opening update: ", err)
@@ -301,18 +283,20 @@ func TestUpdate (t *testing.T) {
 		}
 	}
 
-	CloseUpdate(nodesToUpdate...)
+	err = db.CloseUpdate(nodesToUpdate...)
 
-	InitDb("./data/db", 10 * time.Millisecond)
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
 
-	time.Sleep(waitBetweenWrites * 2)
+	time.Sleep(db.waitBetweenWrites * 2)
 
 	if err != nil {
 		t.Error("error clearing funnel: ", err)
 	}
 
 	for i, v := range initialNodes {
-		updatedNode, err := Get(v)
+		updatedNode, err := db.Get(v)
 
 		if err != nil {
 			t.Error("error getting node.  original data was: ", v.(Node).Data)
@@ -327,3 +311,1335 @@ func TestUpdate (t *testing.T) {
 
 
 }
+
+func TestOpenIsolated (t *testing.T) {
+	db1, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	err = clearDb(db1.path + "_2")
+
+	if err != nil {
+		t.Error("error clearing second db: ", err)
+	}
+
+	db2, err := Open(db1.path + "_2", Options{WriteInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Error("error opening second db: ", err)
+	}
+
+	f0 := forestTest(t, db1, []byte{0})
+
+	_, err = db2.Get(f0)
+
+	if err == nil {
+		t.Error("a forest put in one db should not be visible from another")
+	}
+
+	getChildrenTest(t, db2, rootNode, 0)
+}
+
+func TestCloseTwice (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	db, err := Open(path, Options{WriteAheadLog: true})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	_ = forestTest(t, db, []byte{0})
+
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	//like a deferred Close after an explicit one.
+	err = db.Close()
+
+	if err != nil {
+		t.Error("closing a closed db should do nothing, but returned: ", err)
+	}
+}
+
+func TestReadYourWrites (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	//a long write interval so that nothing leaves the funnel on its own.
+	db, err := Open(path, Options{WriteInterval: time.Hour, ReadYourWrites: true})
+
+	if err != nil {
+		t.Error("error opening db: ", err)
+	}
+
+	defer db.Close()
+
+	fKc, err := db.NewForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	bKc, err := db.NewBranch(fKc, []byte{1})
+
+	if err != nil {
+		t.Error("error making branch: ", err)
+	}
+
+	nodes, err := db.OpenUpdate(bKc)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	nodes[0].Data = []byte{2}
+
+	err = db.CloseUpdate(nodes...)
+
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
+
+	b, err := db.Get(bKc)
+
+	if err != nil {
+		t.Error("error getting branch: ", err)
+	}
+
+	if !bytes.Equal(b.Data, []byte{2}) {
+		t.Error("get did not see the update in the funnel: ", b.Data)
+	}
+
+	f, err := db.Get(fKc)
+
+	if err != nil {
+		t.Error("error getting forest: ", err)
+	}
+
+	//a child that only exists in the funnel so far.
+	pending, err := makeBranch(f, []byte{3})
+
+	if err != nil {
+		t.Error("error making branch: ", err)
+	}
+
+	db.funnel.mutex.Lock()
+	db.bulkPut(pending)
+	db.funnel.mutex.Unlock()
+
+	children, err := db.GetChildren(f)
+
+	if err != nil {
+		t.Error("error getting children: ", err)
+	}
+
+	rangeSearchTest(t, f, children, 2)
+
+	found := false
+
+	for _, c := range children {
+		if c.Equal(b.KeyChain) && !bytes.Equal(c.Data, []byte{2}) {
+			t.Error("get children did not see the update in the funnel: ", c.Data)
+		}
+		if c.Equal(pending.KeyChain) {
+			found = true
+		}
+	}
+
+	if !found {
+		t.Error("get children did not find the node that was only in the funnel")
+	}
+}
+
+func TestUnrelatedUpdatesDontBlock (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	held, err := db.OpenUpdate(f0)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	done := make(chan error)
+
+	go func() {
+		other, err := db.OpenUpdate(f1)
+		if err != nil {
+			done <- err
+			return
+		}
+		other[0].Data = []byte{2}
+		done <- db.CloseUpdate(other...)
+	}()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error("error updating unrelated node: ", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("update of an unrelated node was blocked by an open update")
+	}
+
+	blocked := make(chan error)
+
+	go func() {
+		same, err := db.OpenUpdate(f1, f0)
+		if err != nil {
+			blocked <- err
+			return
+		}
+		blocked <- db.CloseUpdate(same...)
+	}()
+
+	select {
+	case <-blocked:
+		t.Error("update of a node that's already being updated did not block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	err = db.CloseUpdate(held...)
+
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
+
+	err = <-blocked
+
+	if err != nil {
+		t.Error("error updating node once it was released: ", err)
+	}
+}
+
+func TestDelete (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	b0 := branchTest(t, db, f0, []byte{1})
+
+	b1 := branchTest(t, db, b0, []byte{2})
+
+	nodes, err := db.OpenUpdate(b0)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	nodes[0].Data = []byte{3}
+
+	err = db.CloseUpdate(nodes...)
+
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
+
+	//the update is still in the funnel when the delete goes in.
+	err = db.Delete(b0)
+
+	if err != nil {
+		t.Error("error deleting node: ", err)
+	}
+
+	_, err = db.OpenUpdate(b0)
+
+	if err != ErrNotFound {
+		t.Error("deleted node should not be updateable, but open update returned: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing funnel: ", err)
+	}
+
+	_, err = db.Get(b0)
+
+	if err != ErrNotFound {
+		t.Error("deleted node should be gone from the db, but get returned: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{2}, b1)
+
+	err = db.Delete(rootNode)
+
+	if err != ErrRootNode {
+		t.Error("deleting the root should fail, but returned: ", err)
+	}
+}
+
+func TestDeleteSubtree (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	t0 := treeTest(t, db, f0, []byte{2})
+
+	b0 := branchTest(t, db, f0, []byte{3})
+
+	b1 := branchTest(t, db, b0, []byte{4})
+
+	_ = branchTest(t, db, b1, []byte{5})
+
+	t1 := treeTest(t, db, t0, []byte{6})
+
+	_ = branchTest(t, db, t1, []byte{7})
+
+	b2 := branchTest(t, db, f1, []byte{8})
+
+	err = db.DeleteSubtree(b0)
+
+	if err != nil {
+		t.Error("error deleting branch subtree: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing funnel: ", err)
+	}
+
+	getChildrenTest(t, db, b0, 0)
+
+	getChildrenTest(t, db, b1, 0)
+
+	_ = nodeTest(t, db, []byte{2}, t0)
+
+	err = db.DeleteSubtree(f0)
+
+	if err != nil {
+		t.Error("error deleting forest subtree: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing funnel: ", err)
+	}
+
+	getChildrenTest(t, db, f0, 0)
+
+	getChildrenTest(t, db, t0, 0)
+
+	getForestsTest(t, db, 1)
+
+	_, err = db.Get(f0)
+
+	if err != ErrNotFound {
+		t.Error("deleted forest should be gone, but get returned: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{8}, b2)
+}
+
+func siblingTest (t *testing.T, db *DB, original Node, sibling locateable, data []byte) {
+	n := nodeTest(t, db, data, sibling)
+
+	if !n.GetSiblingBucket().Equal(original.GetSiblingBucket()) {
+		t.Error("sibling was not put in the original's sibling bucket",
+			"\noriginal: ", original.GetSiblingBucket(),
+			"\nsibling: ", n.GetSiblingBucket())
+	}
+
+	if !n.GetParentLoc().Equal(original.GetParentLoc()) {
+		t.Error("sibling does not have the original's parent")
+	}
+}
+
+func TestNewSibling (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	t0 := treeTest(t, db, f0, []byte{1})
+
+	b0 := branchTest(t, db, f0, []byte{2})
+
+	b1 := branchTest(t, db, b0, []byte{3})
+
+	sKc, err := db.NewSiblingTree(t0, []byte{4})
+
+	if err != nil {
+		t.Error("error making sibling tree: ", err)
+	}
+
+	siblingTest(t, db, t0, sKc, []byte{4})
+
+	sKc, err = db.NewSiblingBranch(b1, []byte{5})
+
+	if err != nil {
+		t.Error("error making sibling branch: ", err)
+	}
+
+	siblingTest(t, db, b1, sKc, []byte{5})
+
+	//only the keychain is needed, not the node.
+	sKc, err = db.NewSiblingBranch(b0.KeyChain, []byte{6})
+
+	if err != nil {
+		t.Error("error making sibling branch: ", err)
+	}
+
+	siblingTest(t, db, b0, sKc, []byte{6})
+
+	sKc, err = db.NewSiblingTree(f0, []byte{7})
+
+	if err != nil {
+		t.Error("error making sibling forest: ", err)
+	}
+
+	siblingTest(t, db, f0, sKc, []byte{7})
+
+	//b1's parent is a branch, which can't have trees under it.
+	_, err = db.NewSiblingTree(b1, []byte{8})
+
+	if err != keyChain.ErrTreeUnderBranch {
+		t.Error("sibling tree under a branch should fail, but returned: ", err)
+	}
+
+	getSiblingsTest(t, db, t0, 4) // t0, b0 and their siblings
+	getSiblingsTest(t, db, b1, 2)
+	getForestsTest(t, db, 2)
+}
+
+func TestMove (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	b0 := branchTest(t, db, f0, []byte{2})
+
+	b1 := branchTest(t, db, b0, []byte{3})
+
+	_ = branchTest(t, db, b1, []byte{4})
+
+	t0 := treeTest(t, db, f1, []byte{5})
+
+	_ = branchTest(t, db, t0, []byte{6})
+
+	_, err = db.Move(b0, b1)
+
+	if err != ErrMoveIntoSubtree {
+		t.Error("moving a node under its own descendant should fail, but returned: ", err)
+	}
+
+	//branch subtree into a tree in another forest.
+	newB0, err := db.Move(b0, t0)
+
+	if err != nil {
+		t.Error("error moving branch: ", err)
+	}
+
+	movedB0 := nodeTest(t, db, []byte{2}, newB0)
+
+	getChildrenTest(t, db, f0, 0)
+
+	getChildrenTest(t, db, t0, 2)
+
+	getParentTest(t, db, t0, movedB0)
+
+	getChildrenTest(t, db, movedB0, 1)
+
+	children, err := db.GetChildren(movedB0)
+
+	if err != nil || len(children) != 1 {
+		t.Fatal("error getting moved branch's children: ", err)
+	}
+
+	movedB1 := children[0]
+
+	getChildrenTest(t, db, movedB1, 1)
+
+	_, err = db.Get(b1.KeyChain)
+
+	if err != ErrNotFound {
+		t.Error("moved node should be gone from its old location, but get returned: ", err)
+	}
+
+	//tree subtree up to the root.
+	newT0, err := db.Move(t0, rootNode)
+
+	if err != nil {
+		t.Error("error moving tree: ", err)
+	}
+
+	movedT0 := nodeTest(t, db, []byte{5}, newT0)
+
+	getForestsTest(t, db, 3)
+
+	getChildrenTest(t, db, f1, 0)
+
+	getChildrenTest(t, db, movedT0, 2)
+
+	descendants, err := db.GetDescendants(movedT0)
+
+	if err != nil {
+		t.Error("error getting moved tree's descendants: ", err)
+	}
+
+	// its two children and b0's two descendants.
+	rangeSearchTest(t, movedT0, descendants, 4)
+
+	//trees can't go under branches.
+	b2 := branchTest(t, db, f1, []byte{7})
+
+	t1 := treeTest(t, db, f1, []byte{8})
+
+	_, err = db.Move(t1, b2)
+
+	if err != keyChain.ErrTreeUnderBranch {
+		t.Error("moving a tree under a branch should fail, but returned: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{8}, t1)
+}
+
+func TestMoveOrphans (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	t0 := treeTest(t, db, f0, []byte{1})
+
+	b0 := branchTest(t, db, t0, []byte{2})
+
+	b1 := branchTest(t, db, b0, []byte{3})
+
+	_ = branchTest(t, db, t0, []byte{4})
+
+	//b1 is left behind in t0's descendant bucket.
+	err = db.Delete(b0)
+
+	if err != nil {
+		t.Error("error deleting branch: ", err)
+	}
+
+	newT0, err := db.Move(t0, rootNode)
+
+	if err != nil {
+		t.Error("error moving tree: ", err)
+	}
+
+	movedT0 := nodeTest(t, db, []byte{1}, newT0)
+
+	descendants, err := db.GetDescendants(movedT0)
+
+	if err != nil {
+		t.Error("error getting moved tree's descendants: ", err)
+	}
+
+	rangeSearchTest(t, movedT0, descendants, 1)
+
+	//the orphan stays where it was instead of going somewhere made up.
+	_ = nodeTest(t, db, []byte{3}, b1)
+
+	all, err := db.GetDescendants(rootNode)
+
+	if err != nil {
+		t.Error("error getting everything: ", err)
+	}
+
+	rangeSearchTest(t, rootNode, all, 4)
+}
+
+//makes branches under parent from several goroutines while fn runs, and
+//returns how many were made.  Branches made after parent's gone fail with
+//ErrNotFound.
+func createWhile (t *testing.T, db *DB, parent locateable, fn func()) int {
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.NewBranch(parent, []byte{byte(i)})
+			errs <- err
+		}(i)
+	}
+
+	fn()
+
+	wg.Wait()
+	close(errs)
+
+	made := 0
+
+	for err := range errs {
+		if err == nil {
+			made++
+		} else if err != ErrNotFound {
+			t.Error("error making branch: ", err)
+		}
+	}
+
+	return made
+}
+
+func TestMoveWhileCreating (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	t0 := treeTest(t, db, f0, []byte{2})
+
+	b0 := branchTest(t, db, t0, []byte{3})
+
+	var newT0 keyChain.KeyChain
+
+	made := createWhile(t, db, b0, func() {
+		newT0, err = db.Move(t0, f1)
+
+		if err != nil {
+			t.Error("error moving tree: ", err)
+		}
+	})
+
+	movedT0 := nodeTest(t, db, []byte{2}, newT0)
+
+	children, err := db.GetChildren(movedT0)
+
+	if err != nil || len(children) != 1 {
+		t.Fatal("error getting moved branch: ", err)
+	}
+
+	//everything made before the move went with it, and nothing was made
+	//after it.
+	getChildrenTest(t, db, children[0], made)
+
+	all, err := db.GetDescendants(rootNode)
+
+	if err != nil {
+		t.Error("error getting everything: ", err)
+	}
+
+	rangeSearchTest(t, rootNode, all, 4 + made)
+}
+
+func TestDeleteSubtreeWhileCreating (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	t0 := treeTest(t, db, f0, []byte{1})
+
+	b0 := branchTest(t, db, t0, []byte{2})
+
+	_ = createWhile(t, db, b0, func() {
+		err := db.DeleteSubtree(t0)
+
+		if err != nil {
+			t.Error("error deleting subtree: ", err)
+		}
+	})
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	//nothing made under the subtree was left behind.
+	all, err := db.GetDescendants(rootNode)
+
+	if err != nil {
+		t.Error("error getting everything: ", err)
+	}
+
+	rangeSearchTest(t, rootNode, all, 1)
+}
+
+func TestCopySubtree (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	b0 := branchTest(t, db, f0, []byte{2})
+
+	b1 := branchTest(t, db, b0, []byte{3})
+
+	_ = branchTest(t, db, b1, []byte{4})
+
+	t0 := treeTest(t, db, f0, []byte{5})
+
+	_ = branchTest(t, db, t0, []byte{6})
+
+	//branch subtree into another forest.
+	copyKc, err := db.CopySubtree(b0, f1)
+
+	if err != nil {
+		t.Error("error copying branch: ", err)
+	}
+
+	if bytes.Equal(copyKc.Identifier, b0.Identifier) {
+		t.Error("copy should have a new id")
+	}
+
+	b0Copy := nodeTest(t, db, []byte{2}, copyKc)
+
+	getParentTest(t, db, f1, b0Copy)
+
+	getChildrenTest(t, db, b0Copy, 1)
+
+	children, err := db.GetChildren(b0Copy)
+
+	if err != nil || len(children) != 1 {
+		t.Fatal("error getting copy's children: ", err)
+	}
+
+	if !bytes.Equal(children[0].Data, []byte{3}) {
+		t.Error("copy's child has the wrong data: ", children[0].Data)
+	}
+
+	getChildrenTest(t, db, children[0], 1)
+
+	//the original is left alone.
+	getChildrenTest(t, db, f0, 2)
+
+	getChildrenTest(t, db, b1, 1)
+
+	//tree subtree up to the root.
+	copyKc, err = db.CopySubtree(t0, rootNode)
+
+	if err != nil {
+		t.Error("error copying tree: ", err)
+	}
+
+	t0Copy := nodeTest(t, db, []byte{5}, copyKc)
+
+	if !t0Copy.IsTree {
+		t.Error("copy of a tree should be a tree")
+	}
+
+	getForestsTest(t, db, 3)
+
+	getChildrenTest(t, db, t0Copy, 1)
+
+	//a subtree copied into itself is only copied once.
+	_, err = db.CopySubtree(b0, b1)
+
+	if err != nil {
+		t.Error("error copying branch into its own subtree: ", err)
+	}
+
+	getChildrenTest(t, db, b1, 2)
+
+	descendants, err := db.GetDescendants(f0)
+
+	if err != nil {
+		t.Error("error getting forest's descendants: ", err)
+	}
+
+	// the forest's 5 nodes and the 3 copies.
+	rangeSearchTest(t, f0, descendants, 8)
+
+	//trees can't be copied under branches, the same as they can't be moved
+	//there.
+	_, err = db.CopySubtree(t0, b0)
+
+	if err != keyChain.ErrTreeUnderBranch {
+		t.Error("copying a tree under a branch should fail, but returned: ", err)
+	}
+
+	getChildrenTest(t, db, b0, 1)
+}
+
+func TestCopyOrphans (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	t0 := treeTest(t, db, f0, []byte{1})
+
+	b0 := branchTest(t, db, t0, []byte{2})
+
+	_ = branchTest(t, db, b0, []byte{3})
+
+	_ = branchTest(t, db, t0, []byte{4})
+
+	//the mid-level branch goes, leaving its child in t0's descendant bucket.
+	err = db.Delete(b0)
+
+	if err != nil {
+		t.Error("error deleting branch: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	copyKc, err := db.CopySubtree(t0, f0)
+
+	if err != nil {
+		t.Error("error copying tree: ", err)
+	}
+
+	t0Copy := nodeTest(t, db, []byte{1}, copyKc)
+
+	descendants, err := db.GetDescendants(t0Copy)
+
+	if err != nil {
+		t.Error("error getting copy's descendants: ", err)
+	}
+
+	rangeSearchTest(t, t0Copy, descendants, 1)
+
+	//the original, its live child, its orphan and the copy of each of the
+	//first two, and nothing put anywhere else.
+	all, err := db.GetDescendants(rootNode)
+
+	if err != nil {
+		t.Error("error getting everything: ", err)
+	}
+
+	rangeSearchTest(t, rootNode, all, 6)
+}
+
+func isChildTest (t *testing.T, parent Node, child Node) {
+	if !child.GetParentLoc().Equal(parent.GetLoc()) {
+		t.Error("node is not a child of the node before it",
+			"\nparent data: ", parent.Data,
+			"\nchild data: ", child.Data)
+	}
+}
+
+func TestTraverseDescendants (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	b0 := branchTest(t, db, f0, []byte{1})
+
+	b1 := branchTest(t, db, b0, []byte{2})
+
+	b2 := branchTest(t, db, b0, []byte{3})
+
+	_ = branchTest(t, db, b1, []byte{4})
+
+	_ = branchTest(t, db, b2, []byte{5})
+
+	descendants, err := db.GetDescendants(b0)
+
+	if err != nil {
+		t.Error("error getting branch's descendants: ", err)
+	}
+
+	rangeSearchTest(t, b0, descendants, 4)
+
+	descendants, err = db.TraverseDescendants(b0, TraversalOptions{})
+
+	if err != nil {
+		t.Error("error traversing breadth first: ", err)
+	}
+
+	rangeSearchTest(t, b0, descendants, 4)
+
+	if len(descendants) == 4 {
+		for _, d := range descendants[:2] {
+			isChildTest(t, b0, d)
+		}
+	}
+
+	descendants, err = db.TraverseDescendants(b0, TraversalOptions{Order: DepthFirst})
+
+	if err != nil {
+		t.Error("error traversing depth first: ", err)
+	}
+
+	rangeSearchTest(t, b0, descendants, 4)
+
+	if len(descendants) == 4 {
+		isChildTest(t, descendants[0], descendants[1])
+		isChildTest(t, descendants[2], descendants[3])
+	}
+
+	descendants, err = db.TraverseDescendants(b0, TraversalOptions{MaxDepth: 1, Order: DepthFirst})
+
+	if err != nil {
+		t.Error("error traversing one level: ", err)
+	}
+
+	rangeSearchTest(t, b0, descendants, 2)
+
+	descendants, err = db.TraverseDescendants(f0, TraversalOptions{MaxDepth: 2})
+
+	if err != nil {
+		t.Error("error traversing forest: ", err)
+	}
+
+	rangeSearchTest(t, f0, descendants, 3)
+}
+
+func TestGetChildrenPage (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	for i := 0; i < 7; i++ {
+		b := branchTest(t, db, f0, []byte{byte(i + 2)})
+		_ = branchTest(t, db, b, []byte{byte(i + 10)})
+	}
+
+	_ = treeTest(t, db, f1, []byte{20})
+
+	all, err := db.GetChildren(f0)
+
+	if err != nil {
+		t.Error("error getting children: ", err)
+	}
+
+	pages := make([]Node, 0, len(all))
+	var cursor Cursor
+	numPages := 0
+
+	for {
+		var page []Node
+		page, cursor, err = db.GetChildrenPage(f0, cursor, 3)
+
+		if err != nil {
+			t.Fatal("error getting page: ", err)
+		}
+
+		numPages++
+		pages = append(pages, page...)
+
+		if cursor == nil {
+			break
+		}
+
+		if len(page) != 3 {
+			t.Error("page before the last should be full, but had: ", len(page))
+		}
+	}
+
+	if numPages != 3 {
+		t.Error("wrong number of pages: ", numPages)
+	}
+
+	rangeSearchTest(t, f0, pages, len(all))
+
+	for i := range all {
+		if i < len(pages) && !pages[i].Equal(all[i].KeyChain) {
+			t.Error("pages are not in the same order as the children")
+		}
+	}
+
+	//the forests' descendants are skipped even though they're in the bucket.
+	forests, cursor, err := db.GetChildrenPage(rootNode, nil, 1)
+
+	if err != nil {
+		t.Error("error getting page of forests: ", err)
+	}
+
+	rangeSearchTest(t, rootNode, forests, 1)
+
+	forests, cursor, err = db.GetChildrenPage(rootNode, cursor, 1)
+
+	if err != nil {
+		t.Error("error getting page of forests: ", err)
+	}
+
+	rangeSearchTest(t, rootNode, forests, 1)
+
+	if cursor != nil {
+		t.Error("there should be no page after the last forest")
+	}
+
+	_, _, err = db.GetChildrenPage(f0, nil, 0)
+
+	if err != ErrPageLimit {
+		t.Error("a page with no room should fail, but returned: ", err)
+	}
+}
+
+func TestGetAncestors (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	t0 := treeTest(t, db, f0, []byte{1})
+
+	t1 := treeTest(t, db, t0, []byte{2})
+
+	b0 := branchTest(t, db, t1, []byte{3})
+
+	b1 := branchTest(t, db, b0, []byte{4})
+
+	b2 := branchTest(t, db, b1, []byte{5})
+
+	ancestors, err := db.GetAncestors(b2)
+
+	if err != nil {
+		t.Error("error getting ancestors: ", err)
+	}
+
+	rangeSearchTest(t, b2, ancestors, 5)
+
+	for i, a := range ancestors {
+		if !bytes.Equal(a.Data, []byte{byte(4 - i)}) {
+			t.Error("ancestors are out of order",
+				"\nexpected data: ", 4 - i,
+				"\nfound data: ", a.Data)
+		}
+	}
+
+	path, err := db.GetPath(b2)
+
+	if err != nil {
+		t.Error("error getting path: ", err)
+	}
+
+	expected := []Node{f0, t0, t1, b0, b1, b2}
+
+	if len(path) != len(expected) {
+		t.Fatal("path has the wrong length: ", len(path))
+	}
+
+	for i, loc := range path {
+		if !loc.Equal(expected[i].GetLoc()) {
+			t.Error("path has the wrong location at ", i)
+		}
+	}
+
+	ancestors, err = db.GetAncestors(f0)
+
+	if err != nil || len(ancestors) != 0 {
+		t.Error("a forest should have no ancestors: ", len(ancestors), err)
+	}
+
+	//a branch attached to the root.
+	rootBranch, err := db.NewBranch(rootNode, []byte{6})
+
+	if err != nil {
+		t.Error("error making branch on root: ", err)
+	}
+
+	rb := nodeTest(t, db, []byte{6}, rootBranch)
+
+	b3 := branchTest(t, db, rb, []byte{7})
+
+	ancestors, err = db.GetAncestors(b3)
+
+	if err != nil {
+		t.Error("error getting ancestors: ", err)
+	}
+
+	rangeSearchTest(t, b3, ancestors, 1)
+}
+
+//checks the number of nodes at each depth of s.
+func subtreeTest (t *testing.T, s *Subtree, numPerDepth ...int) {
+	level := []*Subtree{s}
+
+	for depth := 0; depth <= len(numPerDepth); depth++ {
+		next := make([]*Subtree, 0)
+
+		for _, n := range level {
+			for _, c := range n.Children {
+				if !c.GetParentLoc().Equal(n.GetLoc()) {
+					t.Error("child was attached to the wrong parent")
+				}
+			}
+			next = append(next, n.Children...)
+		}
+
+		expected := 0
+
+		if depth < len(numPerDepth) {
+			expected = numPerDepth[depth]
+		}
+
+		if len(next) != expected {
+			t.Error("wrong number of nodes at depth ", depth + 1,
+				"\nexpected: ", expected,
+				"\nfound: ", len(next))
+		}
+
+		level = next
+	}
+}
+
+func TestGetSubtree (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	_ = forestTest(t, db, []byte{1})
+
+	t0 := treeTest(t, db, f0, []byte{2})
+
+	b0 := branchTest(t, db, t0, []byte{3})
+
+	b1 := branchTest(t, db, b0, []byte{4})
+
+	_ = branchTest(t, db, b1, []byte{5})
+
+	t1 := treeTest(t, db, t0, []byte{6})
+
+	_ = branchTest(t, db, t1, []byte{7})
+
+	_ = branchTest(t, db, f0, []byte{8})
+
+	s, err := db.GetSubtree(f0, 0)
+
+	if err != nil {
+		t.Error("error getting subtree: ", err)
+	}
+
+	if !bytes.Equal(s.Data, f0.Data) {
+		t.Error("subtree has the wrong node at the top: ", s.Data)
+	}
+
+	subtreeTest(t, s, 2, 2, 2, 1)
+
+	s, err = db.GetSubtree(f0, 2)
+
+	if err != nil {
+		t.Error("error getting subtree: ", err)
+	}
+
+	subtreeTest(t, s, 2, 2)
+
+	s, err = db.GetSubtree(b0, 1)
+
+	if err != nil {
+		t.Error("error getting subtree: ", err)
+	}
+
+	subtreeTest(t, s, 1)
+
+	s, err = db.GetSubtree(rootNode, 3)
+
+	if err != nil {
+		t.Error("error getting subtree: ", err)
+	}
+
+	subtreeTest(t, s, 2, 2, 2)
+}
+
+func TestWalk (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	t0 := treeTest(t, db, f0, []byte{1})
+
+	b0 := branchTest(t, db, t0, []byte{2})
+
+	_ = branchTest(t, db, b0, []byte{3})
+
+	t1 := treeTest(t, db, t0, []byte{4})
+
+	_ = branchTest(t, db, t1, []byte{5})
+
+	b1 := branchTest(t, db, f0, []byte{6})
+
+	_ = branchTest(t, db, b1, []byte{7})
+
+	depths := make(map[byte]int)
+	visited := make([]Node, 0)
+
+	err = db.Walk(f0, func(n Node, depth int) WalkAction {
+		depths[n.Data[0]] = depth
+		visited = append(visited, n)
+		return WalkContinue
+	})
+
+	if err != nil {
+		t.Error("error walking: ", err)
+	}
+
+	rangeSearchTest(t, f0, visited, 8)
+
+	expectedDepths := map[byte]int{0: 0, 1: 1, 2: 2, 3: 3, 4: 2, 5: 3, 6: 1, 7: 2}
+
+	for data, depth := range expectedDepths {
+		if depths[data] != depth {
+			t.Error("node was visited at the wrong depth",
+				"\ndata: ", data,
+				"\nexpected: ", depth,
+				"\nfound: ", depths[data])
+		}
+	}
+
+	//depth first, so every node comes after its parent and before the next
+	//node at its parent's depth.
+	for i := 1; i < len(visited); i++ {
+		if depths[visited[i].Data[0]] > depths[visited[i - 1].Data[0]] {
+			isChildTest(t, visited[i - 1], visited[i])
+		}
+	}
+
+	visited = visited[:0]
+
+	err = db.Walk(f0, func(n Node, depth int) WalkAction {
+		visited = append(visited, n)
+		if n.Equal(t0.KeyChain) {
+			return WalkSkipChildren
+		}
+		return WalkContinue
+	})
+
+	if err != nil {
+		t.Error("error walking: ", err)
+	}
+
+	rangeSearchTest(t, f0, visited, 4)
+
+	visited = visited[:0]
+
+	err = db.Walk(f0, func(n Node, depth int) WalkAction {
+		visited = append(visited, n)
+		if depth == 2 {
+			return WalkStop
+		}
+		return WalkContinue
+	})
+
+	if err != nil {
+		t.Error("error walking: ", err)
+	}
+
+	rangeSearchTest(t, f0, visited, 3)
+
+	visited = visited[:0]
+
+	err = db.Walk(rootNode, func(n Node, depth int) WalkAction {
+		visited = append(visited, n)
+		if depth == 1 {
+			return WalkSkipChildren
+		}
+		return WalkContinue
+	})
+
+	if err != nil {
+		t.Error("error walking root: ", err)
+	}
+
+	if len(visited) != 2 || !visited[0].Equal(rootNode.KeyChain) {
+		t.Error("walking the root should visit it and its forest, but visited: ", len(visited))
+	}
+}
@@ -0,0 +1,200 @@
+package levTree
+
+/*
+The migrate module moves a db's keys to the current version of the key encoding
+(see keyChain/encoding.go) when it's opened.  The version a db's keys are in is
+kept in the meta keyspace; a db without one is either new or from before keys
+had a version.
+
+Version 0 keys can't be read back into locations, but every node's keychain is
+stored along with it, so each node is simply written again under its new key.
+The name index (see names.go) has its parents' keys in its own keys, so its
+entries are moved over to the parents' new keys as well, before the parents
+themselves are moved.  Keys are moved a chunk at a time, and the version is
+only written once they've all been moved.  Old keys and new ones can be told
+apart (see isLegacyKey), so if the process dies partway through the migration
+just carries on with whatever's left the next time the db is opened.  Cursors
+from GetChildrenPage are keys, so ones made before a db was migrated won't work
+after.
+*/
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/AVickory/levTree/keyChain"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Returned by Open when the db's keys are in a newer encoding than this version
+// of levTree can read.
+var ErrKeyVersion = errors.New("levTree: the db's keys are in an unknown encoding")
+
+//where the version of the db's key encoding is kept.
+var keyVersionKey = []byte{metaPrefix, 'v'}
+
+//how many keys are moved in each batch while migrating.
+var migrateChunkSize = 1000
+
+//writes batch and empties it once it's got a chunk's worth of keys in it, or
+//whenever it has anything in it if force is set.
+func (db *DB) writeChunk(batch *leveldb.Batch, force bool) error {
+	if batch.Len() == 0 || (!force && batch.Len() < migrateChunkSize) {
+		return nil
+	}
+
+	err := db.writeBatch(batch)
+
+	if err != nil {
+		fmt.Println("error writing migrated keys: ", err)
+		return err
+	}
+
+	batch.Reset()
+
+	return nil
+}
+
+//whether key is from before keys had a version.  Version 0 keys are either
+//the root's, which was empty, or start with the first byte of a height, which
+//is never anywhere near high enough to be the current version.
+func isLegacyKey(key []byte) bool {
+	return len(key) == 0 || key[0] != keyChain.KeyVersion
+}
+
+//brings the db's keys up to the current version.
+func (db *DB) migrateKeys() error {
+	version, err := db.ldb.Get(keyVersionKey, nil)
+
+	if err == nil {
+		if len(version) != 1 || version[0] != keyChain.KeyVersion {
+			fmt.Println("error reading keys: ", ErrKeyVersion)
+			return ErrKeyVersion
+		}
+
+		return nil
+	} else if err != ErrNotFound {
+		fmt.Println("error reading key version: ", err)
+		return err
+	}
+
+	//names go first, while their parents can still be found under their
+	//old keys.
+	err = db.migrateNames()
+
+	if err != nil {
+		return err
+	}
+
+	err = db.migrateNodes()
+
+	if err != nil {
+		return err
+	}
+
+	return db.ldb.Put(keyVersionKey, []byte{keyChain.KeyVersion}, nil)
+}
+
+//moves the name index entries that still have their parents' old keys over to
+//the parents' new ones.
+func (db *DB) migrateNames() error {
+	batch := new(leveldb.Batch)
+
+	it := db.ldb.NewIterator(util.BytesPrefix(nameIndexPrefix), nil)
+	defer it.Release()
+
+	for it.Next() {
+		key := it.Key()[len(nameIndexPrefix):]
+
+		if len(key) < 4 || uint64(len(key) - 4) < uint64(binary.BigEndian.Uint32(key)) {
+			continue
+		}
+
+		parentEnd := 4 + int(binary.BigEndian.Uint32(key))
+		oldParentKey := key[4:parentEnd]
+
+		if !isLegacyKey(oldParentKey) {
+			continue
+		}
+
+		batch.Delete(it.Key())
+
+		parentKey := rootNode.Key()
+
+		if len(oldParentKey) != 0 {
+			parentSerial, err := db.ldb.Get(oldParentKey, nil)
+
+			//an entry whose parent is gone doesn't count anyway.
+			if err == ErrNotFound {
+				continue
+			} else if err != nil {
+				fmt.Println("error reading named node's parent: ", err)
+				return err
+			}
+
+			var parent Node
+			err = parent.deserialize(parentSerial)
+
+			if err != nil {
+				fmt.Println("error reading named node's parent: ", err)
+				return err
+			}
+
+			parentKey = parent.Key()
+		}
+
+		batch.Put(nameKeyFor(parentKey, string(key[parentEnd:])), it.Value())
+
+		err := db.writeChunk(batch, false)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := it.Error()
+
+	if err != nil {
+		fmt.Println("error reading names to migrate: ", err)
+		return err
+	}
+
+	return db.writeChunk(batch, true)
+}
+
+//writes every node that's still under a version 0 key again under its new key.
+func (db *DB) migrateNodes() error {
+	batch := new(leveldb.Batch)
+
+	it := db.ldb.NewIterator(&util.Range{Limit: []byte{keyChain.KeyVersion}}, nil)
+	defer it.Release()
+
+	for it.Next() {
+		var n Node
+		err := n.deserialize(it.Value())
+
+		if err != nil {
+			fmt.Println("error reading node to migrate: ", err)
+			return err
+		}
+
+		batch.Delete(it.Key())
+		batch.Put(n.Key(), it.Value())
+
+		err = db.writeChunk(batch, false)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	err := it.Error()
+
+	if err != nil {
+		fmt.Println("error reading nodes to migrate: ", err)
+		return err
+	}
+
+	return db.writeChunk(batch, true)
+}
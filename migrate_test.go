@@ -0,0 +1,244 @@
+package levTree
+
+import (
+	"testing"
+	"time"
+	"github.com/AVickory/levTree/keyChain"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+//how keys were made before they had a version.
+func legacyKey (l keyChain.Loc) []byte {
+	key := make([]byte, 0)
+
+	for _, id := range l {
+		if id.Height != 0 {
+			key = append(key, id.Key()[:8]...)
+		}
+		key = append(key, id.Identifier...)
+	}
+
+	return key
+}
+
+func TestMigrateKeys (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	f, err := makeForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	tr, err := makeTree(f, []byte{1})
+
+	if err != nil {
+		t.Error("error making tree: ", err)
+	}
+
+	b, err := makeBranch(tr, []byte{2})
+
+	if err != nil {
+		t.Error("error making branch: ", err)
+	}
+
+	//a version 0 db, written straight to leveldb.
+	ldb, err := leveldb.OpenFile(path, nil)
+
+	if err != nil {
+		t.Fatal("error opening leveldb: ", err)
+	}
+
+	for _, n := range []Node{f, tr, b} {
+		nSerial, err := n.serialize()
+
+		if err != nil {
+			t.Error("error serializing node: ", err)
+		}
+
+		err = ldb.Put(legacyKey(n.GetLoc()), nSerial, nil)
+
+		if err != nil {
+			t.Error("error writing node: ", err)
+		}
+	}
+
+	legacyName := append([]byte{}, nameIndexPrefix...)
+	legacyName = appendLength(legacyName, len(legacyKey(f.GetLoc())))
+	legacyName = append(legacyName, legacyKey(f.GetLoc())...)
+	legacyName = append(legacyName, "archive"...)
+
+	err = ldb.Put(legacyName, tr.Identifier, nil)
+
+	if err != nil {
+		t.Error("error writing name: ", err)
+	}
+
+	ldb.Close()
+
+	db, err := Open(path, Options{WriteInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{0}, f)
+
+	_ = nodeTest(t, db, []byte{2}, b)
+
+	getForestsTest(t, db, 1)
+
+	getChildrenTest(t, db, tr, 1)
+
+	named, err := db.GetChild(f, "archive")
+
+	if err != nil || !named.Equal(tr.KeyChain) {
+		t.Error("name was not migrated: ", err)
+	}
+
+	_, err = db.ldb.Get(legacyKey(b.GetLoc()), nil)
+
+	if err != ErrNotFound {
+		t.Error("old key was left behind: ", err)
+	}
+
+	//a db that's already migrated is left alone.
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	db, err = Open(path, Options{})
+
+	if err != nil {
+		t.Fatal("error reopening db: ", err)
+	}
+
+	getForestsTest(t, db, 1)
+
+	//and one from the future isn't opened at all.
+	err = db.ldb.Put(keyVersionKey, []byte{keyChain.KeyVersion + 1}, nil)
+
+	if err != nil {
+		t.Error("error writing key version: ", err)
+	}
+
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	_, err = Open(path, Options{})
+
+	if err != ErrKeyVersion {
+		t.Error("opening a db with an unknown key version should fail, but returned: ", err)
+	}
+}
+
+func TestResumeMigration (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	//small enough that every key is its own chunk.
+	defer func(size int) { migrateChunkSize = size }(migrateChunkSize)
+	migrateChunkSize = 1
+
+	f, _ := makeForest([]byte{0})
+	tr, _ := makeTree(f, []byte{1})
+	b, _ := makeBranch(tr, []byte{2})
+	s, _ := makeBranch(tr, []byte{3})
+
+	ldb, err := leveldb.OpenFile(path, nil)
+
+	if err != nil {
+		t.Fatal("error opening leveldb: ", err)
+	}
+
+	//a db whose migration died partway through: the names and the forest
+	//have been moved, the rest of the nodes haven't, and there's no version.
+	nodes := map[string]Node{
+		string(f.Key()): f,
+		string(legacyKey(tr.GetLoc())): tr,
+		string(legacyKey(b.GetLoc())): b,
+		string(legacyKey(s.GetLoc())): s,
+	}
+
+	for key, n := range nodes {
+		nSerial, err := n.serialize()
+
+		if err != nil {
+			t.Error("error serializing node: ", err)
+		}
+
+		err = ldb.Put([]byte(key), nSerial, nil)
+
+		if err != nil {
+			t.Error("error writing node: ", err)
+		}
+	}
+
+	err = ldb.Put(nameKey(f, "archive"), tr.Identifier, nil)
+
+	if err != nil {
+		t.Error("error writing name: ", err)
+	}
+
+	//and one name that hasn't been.
+	legacyName := append([]byte{}, nameIndexPrefix...)
+	legacyName = appendLength(legacyName, len(legacyKey(tr.GetLoc())))
+	legacyName = append(legacyName, legacyKey(tr.GetLoc())...)
+	legacyName = append(legacyName, "settings"...)
+
+	err = ldb.Put(legacyName, s.Identifier, nil)
+
+	if err != nil {
+		t.Error("error writing name: ", err)
+	}
+
+	ldb.Close()
+
+	db, err := Open(path, Options{WriteInterval: 10 * time.Millisecond})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	defer db.Close()
+
+	getForestsTest(t, db, 1)
+
+	getChildrenTest(t, db, tr, 2)
+
+	_ = nodeTest(t, db, []byte{2}, b)
+
+	named, err := db.GetChild(f, "archive")
+
+	if err != nil || !named.Equal(tr.KeyChain) {
+		t.Error("migrated name was lost: ", err)
+	}
+
+	named, err = db.GetChild(tr, "settings")
+
+	if err != nil || !named.Equal(s.KeyChain) {
+		t.Error("name was not migrated: ", err)
+	}
+
+	version, err := db.ldb.Get(keyVersionKey, nil)
+
+	if err != nil || version[0] != keyChain.KeyVersion {
+		t.Error("key version was not written: ", version, err)
+	}
+}
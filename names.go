@@ -0,0 +1,363 @@
+package levTree
+
+/*
+The names module lets children be given names that they can be looked up by,
+so that finding the child called "settings" doesn't mean reading every child.
+Each name is an entry in an index that maps the parent and the name to the
+child's identifier.  Names are unique among a parent's children, but the same
+name can be used under different parents.
+
+The index lives in the db's meta keyspace, which starts with a byte that no
+node's key can start with, so scans of the db's nodes never see it.  A named
+node is written along with its index entry in a single batch, so a name can
+never point at a node that hasn't been written.  Moving, reordering or
+copying nodes rewrites the entries for them and their descendants in the same
+batch as the nodes.  Deleting a named node leaves its entry behind, but an
+entry whose node is gone doesn't count, so the name can be given to a new
+child.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/AVickory/levTree/keyChain"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Returned when a parent already has a child with the name being given.
+var ErrNameTaken = errors.New("levTree: the parent already has a child with that name")
+
+//the first byte of every key in the meta keyspace.  Node keys start with the
+//version of their encoding, which is nowhere near it.
+const metaPrefix byte = 0xff
+
+//the start of every name index key.
+var nameIndexPrefix = []byte{metaPrefix, 'n'}
+
+//the index key for name under parent.  The parent's key is preceded by its
+//length, so that no parent's key and name can run together into another's.
+func nameKey(parent locateable, name string) []byte {
+	return nameKeyFor(parent.GetLoc().Key(), name)
+}
+
+//the index key for name under the parent whose key is parentKey.
+func nameKeyFor(parentKey []byte, name string) []byte {
+	key := make([]byte, 0, len(nameIndexPrefix) + 4 + len(parentKey) + len(name))
+	key = append(key, nameIndexPrefix...)
+	key = appendLength(key, len(parentKey))
+	key = append(key, parentKey...)
+
+	return append(key, name...)
+}
+
+//finds the node named name under parent.  Returns ErrNotFound if there isn't
+//one, including when the name's entry is left over from a deleted node.
+func (db *DB) getNamedNode(parent locateable, name string) (Node, error) {
+	identifier, err := db.ldb.Get(nameKey(parent, name), nil)
+
+	if err != nil {
+		return Node{}, err
+	}
+
+	var kc keyChain.KeyChain
+
+	if parent.GetLoc().Equal(rootNode.GetLoc()) {
+		kc = rootNode.Adopt(keyChain.KeyChain{Id: keyChain.Id{Identifier: identifier}})
+	} else {
+		p, err := db.getNode(parent.GetLoc())
+
+		if err != nil {
+			return Node{}, err
+		}
+
+		kc = p.Adopt(keyChain.KeyChain{Id: keyChain.Id{Identifier: identifier}})
+	}
+
+	return db.getNode(kc.GetLoc())
+}
+
+//writes n and its name in a single batch, unless parent already has a child
+//with that name.
+func (db *DB) createNamedNode(parent locateable, name string, n Node) error {
+	key := nameKey(parent, name)
+
+	//other children being given the same name wait here.  Name keys sort
+	//after node keys, so they're locked after the nodes, the same as Move.
+	locks := append(createLocks(n), string(key))
+
+	db.locks.lock(locks...)
+	defer db.locks.unlock(locks...)
+
+	_, err := db.getNamedNode(parent, name)
+
+	if err == nil {
+		fmt.Println("error naming node: ", ErrNameTaken)
+		return ErrNameTaken
+	} else if err != ErrNotFound {
+		fmt.Println("error checking name: ", err)
+		return err
+	}
+
+	nSerial, err := n.serialize()
+
+	if err != nil {
+		fmt.Println("error putting node: ", err)
+		return err
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put(n.Key(), nSerial)
+	batch.Put(key, n.Identifier)
+
+	return db.createWith(batch, n)
+}
+
+//a name from the index and the identifier of the child it's for.
+type nameEntry struct {
+	name string
+	identifier []byte
+}
+
+//gets the names given to children of the node at parentKey.  Entries left over
+//from deleted nodes are included.
+func (db *DB) childNames(parentKey []byte) ([]nameEntry, error) {
+	prefix := nameKeyFor(parentKey, "")
+
+	it := db.ldb.NewIterator(util.BytesPrefix(prefix), nil)
+	defer it.Release()
+
+	names := make([]nameEntry, 0)
+
+	for it.Next() {
+		names = append(names, nameEntry{
+			name: string(it.Key()[len(prefix):]),
+			identifier: append([]byte{}, it.Value()...),
+		})
+	}
+
+	err := it.Error()
+
+	if err != nil {
+		fmt.Println("error reading names: ", err)
+		return nil, err
+	}
+
+	return names, nil
+}
+
+//gets the names that n has been given.  cache holds the names under each parent
+//that's already been read, by the parent's key.
+func (db *DB) namesOf(cache map[string][]nameEntry, n Node) ([]string, error) {
+	parentKey := n.ParentKey()
+
+	entries, found := cache[string(parentKey)]
+
+	if !found {
+		var err error
+		entries, err = db.childNames(parentKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cache[string(parentKey)] = entries
+	}
+
+	names := make([]string, 0)
+
+	for _, e := range entries {
+		if bytes.Equal(e.identifier, n.Identifier) {
+			names = append(names, e.name)
+		}
+	}
+
+	return names, nil
+}
+
+//locks name under parent so that nothing else can be given it, and reports
+//whether a child of parent already has it.  The lock has to be released with
+//db.locks.unlock(key) once the name's been written or given up on.
+func (db *DB) lockName(parent locateable, name string) (key string, taken bool, err error) {
+	key = string(nameKey(parent, name))
+
+	db.locks.lock(key)
+
+	_, err = db.getNamedNode(parent, name)
+
+	if err == nil {
+		return key, true, nil
+	} else if err != ErrNotFound {
+		db.locks.unlock(key)
+		fmt.Println("error checking name: ", err)
+		return "", false, err
+	}
+
+	return key, false, nil
+}
+
+//adds to batch what's needed to keep the names of moved nodes pointing at them.
+//olds are the nodes as they were and news are where they've moved to, with the
+//top of the move first.  The top is the only one whose parent can already
+//have children, so if its name is taken under its new parent the move fails
+//with ErrNameTaken.  Returns the name keys it's locked, which have to be
+//unlocked once batch is written.
+func (db *DB) moveNames(batch *leveldb.Batch, newParent locateable, olds, news []Node) ([]string, error) {
+	cache := make(map[string][]nameEntry)
+	locked := make([]string, 0)
+
+	for i, old := range olds {
+		names, err := db.namesOf(cache, old)
+
+		if err != nil {
+			return locked, err
+		}
+
+		for _, name := range names {
+			oldKey := nameKeyFor(old.ParentKey(), name)
+			newKey := nameKeyFor(news[i].ParentKey(), name)
+
+			//the top is going to a new parent.
+			if i == 0 && !bytes.Equal(oldKey, newKey) {
+				key, taken, err := db.lockName(newParent, name)
+
+				if err != nil {
+					return locked, err
+				}
+
+				locked = append(locked, key)
+
+				if taken {
+					fmt.Println("error moving name: ", ErrNameTaken)
+					return locked, ErrNameTaken
+				}
+			}
+
+			batch.Delete(oldKey)
+			batch.Put(newKey, news[i].Identifier)
+		}
+	}
+
+	return locked, nil
+}
+
+//adds to batch the names of copied nodes, so that each copy has the names of
+//its original.  originals and copies line up, with the top of the copy first.
+//The top's names are only given to its copy if they're free under the copy's
+//parent, since it's usually copied next to its original.  Returns the name
+//keys it's locked, which have to be unlocked once batch is written.
+func (db *DB) copyNames(batch *leveldb.Batch, dstParent locateable, originals, copies []Node) ([]string, error) {
+	cache := make(map[string][]nameEntry)
+	locked := make([]string, 0)
+
+	for i, original := range originals {
+		names, err := db.namesOf(cache, original)
+
+		if err != nil {
+			return locked, err
+		}
+
+		for _, name := range names {
+			if i == 0 {
+				key, taken, err := db.lockName(dstParent, name)
+
+				if err != nil {
+					return locked, err
+				}
+
+				locked = append(locked, key)
+
+				if taken {
+					continue
+				}
+			}
+
+			batch.Put(nameKeyFor(copies[i].ParentKey(), name), copies[i].Identifier)
+		}
+	}
+
+	return locked, nil
+}
+
+// Makes and persists a branch under parent that can be found with
+// GetChild(parent, name).  If parent already has a child named name it fails
+// with ErrNameTaken.  Modifications to the returned branch cannot be persisted.
+func (db *DB) NewNamedBranch(parent locateable, name string, data []byte) (locateable, error) {
+	newBranch, err := makeBranch(parent, data)
+
+	if err != nil {
+		fmt.Println("error making branch Node: ", err)
+		return nil, err
+	}
+
+	err = db.assignId(&newBranch)
+
+	if err != nil {
+		fmt.Println("error making branch id: ", err)
+		return nil, err
+	}
+
+	err = db.createNamedNode(parent, name, newBranch)
+
+	if err != nil {
+		fmt.Println("error putting named branch in db: ", err)
+		return nil, err
+	}
+
+	return newBranch.KeyChain, nil
+}
+
+// Makes and persists a tree under parent that can be found with
+// GetChild(parent, name).  If parent already has a child named name it fails
+// with ErrNameTaken.  Modifications to the returned tree cannot be persisted.
+func (db *DB) NewNamedTree(parent locateable, name string, data []byte) (locateable, error) {
+	newTree, err := makeTree(parent, data)
+
+	if err != nil {
+		fmt.Println("error making tree Node: ", err)
+		return nil, err
+	}
+
+	err = db.assignId(&newTree)
+
+	if err != nil {
+		fmt.Println("error making tree id: ", err)
+		return nil, err
+	}
+
+	err = db.createNamedNode(parent, name, newTree)
+
+	if err != nil {
+		fmt.Println("error putting named tree in db: ", err)
+		return nil, err
+	}
+
+	return newTree.KeyChain, nil
+}
+
+// Makes and persists a forest that can be found with GetForestByName(name).  If
+// there's already a forest named name it fails with ErrNameTaken.
+// Modifications to the returned forest cannot be persisted.
+func (db *DB) NewNamedForest(name string, data []byte) (locateable, error) {
+	return db.NewNamedTree(rootNode, name, data)
+}
+
+// Gets parent's child called name.  Returns ErrNotFound if it doesn't have one.
+// Modifications to the returned Node cannot be persisted.
+func (db *DB) GetChild(parent locateable, name string) (Node, error) {
+	n, err := db.getNamedNode(parent, name)
+
+	if err != nil {
+		fmt.Println("error getting named child: ", err)
+		return n, err
+	}
+
+	return n, nil
+}
+
+// Gets the forest called name.  Returns ErrNotFound if there isn't one.
+// Modifications to the returned Node cannot be persisted.
+func (db *DB) GetForestByName(name string) (Node, error) {
+	return db.GetChild(rootNode, name)
+}
@@ -0,0 +1,285 @@
+package levTree
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestNamedChildren (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	fKc, err := db.NewNamedForest("projects", []byte{0})
+
+	if err != nil {
+		t.Error("error making named forest: ", err)
+	}
+
+	f, err := db.GetForestByName("projects")
+
+	if err != nil {
+		t.Error("error getting forest by name: ", err)
+	}
+
+	if !f.GetLoc().Equal(fKc.GetLoc()) {
+		t.Error("got the wrong forest")
+	}
+
+	_, err = db.NewNamedForest("projects", []byte{1})
+
+	if err != ErrNameTaken {
+		t.Error("forest names should be unique, but making a second one returned: ", err)
+	}
+
+	_, err = db.NewNamedBranch(f, "settings", []byte{2})
+
+	if err != nil {
+		t.Error("error making named branch: ", err)
+	}
+
+	tKc, err := db.NewNamedTree(f, "archive", []byte{3})
+
+	if err != nil {
+		t.Error("error making named tree: ", err)
+	}
+
+	//the same name under a different parent is fine.
+	_, err = db.NewNamedBranch(tKc, "settings", []byte{4})
+
+	if err != nil {
+		t.Error("error making named branch under another parent: ", err)
+	}
+
+	_, err = db.NewNamedBranch(f, "settings", []byte{5})
+
+	if err != ErrNameTaken {
+		t.Error("names should be unique per parent, but returned: ", err)
+	}
+
+	s, err := db.GetChild(f, "settings")
+
+	if err != nil {
+		t.Error("error getting named child: ", err)
+	}
+
+	if !bytes.Equal(s.Data, []byte{2}) {
+		t.Error("got the wrong child: ", s.Data)
+	}
+
+	s, err = db.GetChild(tKc, "settings")
+
+	if err != nil {
+		t.Error("error getting named child: ", err)
+	}
+
+	if !bytes.Equal(s.Data, []byte{4}) {
+		t.Error("got the wrong child: ", s.Data)
+	}
+
+	_, err = db.GetChild(f, "missing")
+
+	if err != ErrNotFound {
+		t.Error("a name that was never given should not be found, but returned: ", err)
+	}
+
+	//the index isn't seen by scans of the root.
+	getForestsTest(t, db, 1)
+
+	getChildrenTest(t, db, f, 2)
+
+	//a deleted child's name can be given out again.
+	err = db.Delete(s)
+
+	if err != nil {
+		t.Error("error deleting named child: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	_, err = db.GetChild(tKc, "settings")
+
+	if err != ErrNotFound {
+		t.Error("a deleted child should not be found by name, but returned: ", err)
+	}
+
+	_, err = db.NewNamedBranch(tKc, "settings", []byte{6})
+
+	if err != nil {
+		t.Error("error reusing deleted child's name: ", err)
+	}
+}
+
+func TestConcurrentNames (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f := forestTest(t, db, []byte{0})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := db.NewNamedBranch(f, "only", []byte{byte(i)})
+			errs <- err
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	made := 0
+
+	for err := range errs {
+		if err == nil {
+			made++
+		} else if err != ErrNameTaken {
+			t.Error("error making named branch: ", err)
+		}
+	}
+
+	if made != 1 {
+		t.Error("exactly one child should get the name, but ", made, " did")
+	}
+
+	getChildrenTest(t, db, f, 1)
+}
+
+//checks that the child of parent called name is at l.
+func namedChildTest (t *testing.T, db *DB, parent locateable, name string, l locateable) {
+	named, err := db.GetChild(parent, name)
+
+	if err != nil {
+		t.Error("error getting named child ", name, ": ", err)
+		return
+	}
+
+	if !named.GetLoc().Equal(l.GetLoc()) {
+		t.Error("name ", name, " is on the wrong node",
+			"\nexpected: ", l.GetLoc(),
+			"\nfound: ", named.GetLoc())
+	}
+}
+
+func TestNamesFollowNodes (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f := forestTest(t, db, []byte{0})
+	g := forestTest(t, db, []byte{1})
+
+	folder, err := db.NewNamedTree(f, "folder", []byte{2})
+
+	if err != nil {
+		t.Fatal("error making named tree: ", err)
+	}
+
+	_, err = db.NewNamedBranch(folder, "settings", []byte{3})
+
+	if err != nil {
+		t.Fatal("error making named branch: ", err)
+	}
+
+	//the node and its descendants keep their names when they're moved.
+	moved, err := db.Move(folder, g)
+
+	if err != nil {
+		t.Fatal("error moving named tree: ", err)
+	}
+
+	namedChildTest(t, db, g, "folder", moved)
+
+	settings, err := db.GetChild(moved, "settings")
+
+	if err != nil || !bytes.Equal(settings.Data, []byte{3}) {
+		t.Error("descendant's name was lost in the move: ", err)
+	}
+
+	_, err = db.GetChild(f, "folder")
+
+	if err != ErrNotFound {
+		t.Error("name should have left with the node, but returned: ", err)
+	}
+
+	//a move onto a name that's taken fails and leaves the node where it was.
+	other, err := db.NewNamedTree(f, "folder", []byte{4})
+
+	if err != nil {
+		t.Fatal("error reusing moved node's name: ", err)
+	}
+
+	_, err = db.Move(other, g)
+
+	if err != ErrNameTaken {
+		t.Error("moving onto a taken name should fail, but returned: ", err)
+	}
+
+	namedChildTest(t, db, f, "folder", other)
+
+	namedChildTest(t, db, g, "folder", moved)
+
+	//copies get the names of their originals, apart from the top when its
+	//name is taken.
+	copied, err := db.CopySubtree(moved, f)
+
+	if err != nil {
+		t.Fatal("error copying named tree: ", err)
+	}
+
+	namedChildTest(t, db, f, "folder", other)
+
+	settings, err = db.GetChild(copied, "settings")
+
+	if err != nil || !bytes.Equal(settings.Data, []byte{3}) {
+		t.Error("descendant's name was not copied: ", err)
+	}
+
+	h := forestTest(t, db, []byte{5})
+
+	copied, err = db.CopySubtree(moved, h)
+
+	if err != nil {
+		t.Fatal("error copying named tree: ", err)
+	}
+
+	namedChildTest(t, db, h, "folder", copied)
+
+	namedChildTest(t, db, g, "folder", moved)
+
+	//and reordering keeps them too.
+	reordered, err := db.Reorder(moved, 0)
+
+	if err != nil {
+		t.Fatal("error reordering named tree: ", err)
+	}
+
+	namedChildTest(t, db, g, "folder", reordered)
+
+	settings, err = db.GetChild(reordered, "settings")
+
+	if err != nil || !bytes.Equal(settings.Data, []byte{3}) {
+		t.Error("descendant's name was lost in the reorder: ", err)
+	}
+}
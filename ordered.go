@@ -0,0 +1,291 @@
+package levTree
+
+/*
+The ordered module keeps a parent's children in whatever order they're put in,
+for things like chapters or playlists.  Children come off of the db in the order
+of their ids, so an ordered child's id starts with a position (see
+keyChain/position.go) that's made to sort between the siblings on either side
+of where it's going.  Putting a child in or moving it around only ever changes
+that one child's id, so GetChildren returns the children in order without any
+of the other siblings having to be rewritten.
+
+A parent's children should either all be ordered or all not be, since the ids
+of children that weren't given positions sort wherever they happen to.  Ordered
+children are marked as such (see Node.Ordered), so that copies of them can be
+given the same positions.
+Reordering a child changes its key, and so the keys of its descendants, so
+it's done the same way as Move.
+*/
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/AVickory/levTree/keyChain"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// Returned when an index is past either end of the children it's into.
+var ErrIndexOutOfRange = errors.New("levTree: index is out of range")
+
+//makes a position between the nodes lo and hi, either of which can be missing.
+func positionBetween(lo, hi *Node) ([]byte, error) {
+	var loPosition, hiPosition []byte
+
+	if lo != nil {
+		loPosition = lo.Position()
+	}
+
+	if hi != nil {
+		hiPosition = hi.Position()
+	}
+
+	return keyChain.PositionBetween(loPosition, hiPosition)
+}
+
+//makes a position that puts a node at index among the nodes from it, which
+//are in order, not counting skip.  Only the nodes up to index are read, and it
+//is released.
+func positionAt(it *Iterator, index int, skip locateable) ([]byte, error) {
+	defer it.Release()
+
+	if index < 0 {
+		return nil, ErrIndexOutOfRange
+	}
+
+	var lo, hi *Node
+	i := 0
+
+	for it.Next() {
+		n := it.Node()
+
+		if skip != nil && n.GetLoc().Equal(skip.GetLoc()) {
+			continue
+		}
+
+		if i == index {
+			hi = &n
+			break
+		}
+
+		lo = &n
+		i++
+	}
+
+	if it.Err() != nil {
+		return nil, it.Err()
+	}
+
+	if i < index {
+		return nil, ErrIndexOutOfRange
+	}
+
+	return positionBetween(lo, hi)
+}
+
+//makes a position offset places after sibling, so 0 puts it right before
+//sibling and 1 right after, not counting skip.  The db is sought straight to
+//sibling, so only it and the sibling next to it are read.
+func (db *DB) positionNextTo(sibling locateable, offset int, skip locateable) ([]byte, error) {
+	key := sibling.GetLoc().Key()
+
+	it := db.ldb.NewIterator(util.BytesPrefix(sibling.GetSiblingBucket().Key()), nil)
+	defer it.Release()
+
+	if !it.Seek(key) || !bytes.Equal(it.Key(), key) {
+		if it.Error() != nil {
+			return nil, it.Error()
+		}
+
+		return nil, ErrNotFound
+	}
+
+	var s Node
+	err := s.deserialize(it.Value())
+
+	if err != nil {
+		return nil, err
+	}
+
+	step := it.Next
+
+	if offset == 0 {
+		step = it.Prev
+	}
+
+	var other *Node
+
+	//anything in the bucket that isn't a child of sibling's parent is
+	//stepped over.
+	for other == nil && step() {
+		var n Node
+		err = n.deserialize(it.Value())
+
+		if err != nil || !n.GetParentLoc().Equal(s.GetParentLoc()) {
+			continue
+		}
+
+		if skip != nil && n.GetLoc().Equal(skip.GetLoc()) {
+			continue
+		}
+
+		other = &n
+	}
+
+	if it.Error() != nil {
+		return nil, it.Error()
+	}
+
+	if offset == 0 {
+		return positionBetween(other, &s)
+	}
+
+	return positionBetween(&s, other)
+}
+
+//makes and persists a branch laid out like kc, but with an id at position.
+func (db *DB) createBranchAt(kc keyChain.KeyChain, position []byte, data []byte) (locateable, error) {
+	var err error
+	kc.Id, err = keyChain.MakePositionId(kc.Id.Height, position)
+
+	if err != nil {
+		fmt.Println("error making ordered id: ", err)
+		return nil, err
+	}
+
+	newBranch := Node{
+		KeyChain: kc,
+		Data: data,
+		Ordered: true,
+	}
+
+	err = db.createNode(newBranch)
+
+	if err != nil {
+		fmt.Println("error putting ordered branch in db: ", err)
+		return nil, err
+	}
+
+	return newBranch.KeyChain, nil
+}
+
+// Makes and persists a branch that will be at index among parent's ordered
+// children, so 0 puts it first and the number of children puts it last.
+// Modifications to the returned branch cannot be persisted.
+func (db *DB) InsertChildAt(parent locateable, index int, data []byte) (locateable, error) {
+	position, err := positionAt(db.IterChildren(parent), index, nil)
+
+	if err != nil {
+		fmt.Println("error inserting child: ", err)
+		return nil, err
+	}
+
+	kc, err := parent.MakeChildBranch()
+
+	if err != nil {
+		fmt.Println("error getting new location", err)
+		return nil, err
+	}
+
+	return db.createBranchAt(kc, position, data)
+}
+
+//makes and persists a branch offset places after sibling, so 0 puts it right
+//before sibling and 1 right after.
+func (db *DB) insertNextTo(sibling locateable, offset int, data []byte) (locateable, error) {
+	position, err := db.positionNextTo(sibling, offset, nil)
+
+	if err != nil {
+		fmt.Println("error inserting next to sibling: ", err)
+		return nil, err
+	}
+
+	kc, err := sibling.MakeSiblingBranch()
+
+	if err != nil {
+		fmt.Println("error getting new location", err)
+		return nil, err
+	}
+
+	return db.createBranchAt(kc, position, data)
+}
+
+// Makes and persists a branch that comes right before sibling among its
+// ordered siblings.  Modifications to the returned branch cannot be persisted.
+func (db *DB) InsertBefore(sibling locateable, data []byte) (locateable, error) {
+	return db.insertNextTo(sibling, 0, data)
+}
+
+// Makes and persists a branch that comes right after sibling among its ordered
+// siblings.  Modifications to the returned branch cannot be persisted.
+func (db *DB) InsertAfter(sibling locateable, data []byte) (locateable, error) {
+	return db.insertNextTo(sibling, 1, data)
+}
+
+//gives n a new id at position, moving its descendants along with it.
+func (db *DB) reposition(n locateable, position []byte) (keyChain.KeyChain, error) {
+	parent := rootNode
+
+	if !n.GetParentLoc().Equal(rootNode.GetLoc()) {
+		var err error
+		parent, err = db.GetParent(n)
+
+		if err != nil {
+			fmt.Println("error getting parent: ", err)
+			return keyChain.KeyChain{}, err
+		}
+	}
+
+	id, err := keyChain.MakePositionId(n.GetLoc().GetId().Height, position)
+
+	if err != nil {
+		fmt.Println("error making ordered id: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	return db.moveSubtree(n, parent, id.Identifier)
+}
+
+// Moves the node at n to index among its ordered siblings (not counting
+// itself), and returns its new location.  Only n and its descendants are
+// rewritten, and they're written the same way as Move, so locations read
+// before the move are no good afterwards.
+func (db *DB) Reorder(n locateable, index int) (keyChain.KeyChain, error) {
+	position, err := positionAt(db.IterSiblings(n), index, n)
+
+	if err != nil {
+		fmt.Println("error reordering node: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	return db.reposition(n, position)
+}
+
+//moves n to be offset places after sibling, so 0 puts it right before sibling
+//and 1 right after.
+func (db *DB) reorderNextTo(n, sibling locateable, offset int) (keyChain.KeyChain, error) {
+	//n isn't one of its own siblings.
+	if n.GetLoc().Equal(sibling.GetLoc()) {
+		fmt.Println("error reordering node: ", ErrNotFound)
+		return keyChain.KeyChain{}, ErrNotFound
+	}
+
+	position, err := db.positionNextTo(sibling, offset, n)
+
+	if err != nil {
+		fmt.Println("error reordering node: ", err)
+		return keyChain.KeyChain{}, err
+	}
+
+	return db.reposition(n, position)
+}
+
+// Moves the node at n to come right before sibling, like Reorder.
+func (db *DB) ReorderBefore(n, sibling locateable) (keyChain.KeyChain, error) {
+	return db.reorderNextTo(n, sibling, 0)
+}
+
+// Moves the node at n to come right after sibling, like Reorder.
+func (db *DB) ReorderAfter(n, sibling locateable) (keyChain.KeyChain, error) {
+	return db.reorderNextTo(n, sibling, 1)
+}
@@ -0,0 +1,246 @@
+package levTree
+
+import (
+	"testing"
+)
+
+//checks that parent's children are in the order of data.
+func orderTest (t *testing.T, db *DB, parent locateable, data ...byte) {
+	children, err := db.GetChildren(parent)
+
+	if err != nil {
+		t.Error("error getting children: ", err)
+	}
+
+	found := make([]byte, len(children))
+
+	for i, c := range children {
+		found[i] = c.Data[0]
+	}
+
+	if string(found) != string(data) {
+		t.Error("children are in the wrong order",
+			"\nexpected: ", data,
+			"\nfound: ", found)
+	}
+}
+
+func TestOrderedChildren (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f := forestTest(t, db, []byte{0})
+
+	c1, err := db.InsertChildAt(f, 0, []byte{1})
+
+	if err != nil {
+		t.Error("error inserting child: ", err)
+	}
+
+	_, err = db.InsertChildAt(f, 0, []byte{2})
+
+	if err != nil {
+		t.Error("error inserting child: ", err)
+	}
+
+	_, err = db.InsertChildAt(f, 2, []byte{3})
+
+	if err != nil {
+		t.Error("error inserting child: ", err)
+	}
+
+	_, err = db.InsertChildAt(f, 1, []byte{4})
+
+	if err != nil {
+		t.Error("error inserting child: ", err)
+	}
+
+	orderTest(t, db, f, 2, 4, 1, 3)
+
+	_, err = db.InsertChildAt(f, 5, []byte{5})
+
+	if err != ErrIndexOutOfRange {
+		t.Error("inserting past the end should fail, but returned: ", err)
+	}
+
+	_, err = db.InsertBefore(c1, []byte{5})
+
+	if err != nil {
+		t.Error("error inserting before: ", err)
+	}
+
+	_, err = db.InsertAfter(c1, []byte{6})
+
+	if err != nil {
+		t.Error("error inserting after: ", err)
+	}
+
+	orderTest(t, db, f, 2, 4, 5, 1, 6, 3)
+
+	//a child with descendants, which move with it.
+	_, err = db.InsertChildAt(c1, 0, []byte{7})
+
+	if err != nil {
+		t.Error("error inserting grandchild: ", err)
+	}
+
+	moved, err := db.Reorder(c1, 0)
+
+	if err != nil {
+		t.Error("error reordering: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	orderTest(t, db, f, 1, 2, 4, 5, 6, 3)
+
+	orderTest(t, db, moved, 7)
+
+	children, err := db.GetChildren(f)
+
+	if err != nil || len(children) != 6 {
+		t.Fatal("error getting children: ", err)
+	}
+
+	moved, err = db.ReorderAfter(children[0], children[5])
+
+	if err != nil {
+		t.Error("error reordering after: ", err)
+	}
+
+	_, err = db.ReorderBefore(children[4], children[1])
+
+	if err != nil {
+		t.Error("error reordering before: ", err)
+	}
+
+	err = db.Flush()
+
+	if err != nil {
+		t.Error("error flushing: ", err)
+	}
+
+	orderTest(t, db, f, 6, 2, 4, 5, 3, 1)
+
+	orderTest(t, db, moved, 7)
+
+	_, err = db.Reorder(moved, 6)
+
+	if err != ErrIndexOutOfRange {
+		t.Error("reordering past the end should fail, but returned: ", err)
+	}
+
+	//there's nothing on the far side of either end.
+	children, err = db.GetChildren(f)
+
+	if err != nil || len(children) != 6 {
+		t.Fatal("error getting children: ", err)
+	}
+
+	_, err = db.InsertBefore(children[0], []byte{8})
+
+	if err != nil {
+		t.Error("error inserting before the first child: ", err)
+	}
+
+	_, err = db.InsertAfter(children[5], []byte{9})
+
+	if err != nil {
+		t.Error("error inserting after the last child: ", err)
+	}
+
+	orderTest(t, db, f, 8, 6, 2, 4, 5, 3, 1, 9)
+
+	_, err = db.ReorderBefore(children[0], children[0])
+
+	if err != ErrNotFound {
+		t.Error("a node can't be reordered next to itself, but returned: ", err)
+	}
+}
+
+func TestCopyOrdered (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f := forestTest(t, db, []byte{0})
+	g := forestTest(t, db, []byte{1})
+
+	p, err := db.NewTree(f, []byte{2})
+
+	if err != nil {
+		t.Fatal("error making tree: ", err)
+	}
+
+	for i, index := range []int{0, 0, 2, 1, 0, 3} {
+		_, err = db.InsertChildAt(p, index, []byte{byte(i + 1)})
+
+		if err != nil {
+			t.Error("error inserting child: ", err)
+		}
+	}
+
+	orderTest(t, db, p, 5, 2, 4, 6, 1, 3)
+
+	copied, err := db.CopySubtree(p, g)
+
+	if err != nil {
+		t.Fatal("error copying ordered tree: ", err)
+	}
+
+	orderTest(t, db, copied, 5, 2, 4, 6, 1, 3)
+
+	//and the copies can still be put in between.
+	_, err = db.InsertChildAt(copied, 1, []byte{7})
+
+	if err != nil {
+		t.Error("error inserting into copy: ", err)
+	}
+
+	orderTest(t, db, copied, 5, 7, 2, 4, 6, 1, 3)
+
+	//a node that isn't ordered is copied with its forest's generator, even
+	//if its id looks like a position.
+	db.SetForestIdGenerator(g, &lookalikeIds{})
+
+	b, err := db.NewBranch(g, []byte{8})
+
+	if err != nil {
+		t.Fatal("error making branch: ", err)
+	}
+
+	bCopy, err := db.CopySubtree(b, g)
+
+	if err != nil {
+		t.Fatal("error copying branch: ", err)
+	}
+
+	n, err := db.Get(bCopy)
+
+	if err != nil || n.Ordered || n.Id.Identifier[0] != 2 {
+		t.Error("unordered copy was given a position: ", n.Id.Identifier, err)
+	}
+}
+
+//makes ids that are shaped like ordered ones.
+type lookalikeIds struct {
+	count byte
+}
+
+func (g *lookalikeIds) NewIdentifier(data []byte) ([]byte, error) {
+	g.count++
+	return []byte{g.count, 0, 1, 2, 3, 4, 5, 6, 7, g.count}, nil
+}
@@ -34,8 +34,8 @@ coming from a SQL background, then you might think about forests as your
 database's tables and a forest's child trees as sub tables.
 
 Root - the bottom namespace of the database.  This Node is just a place to hold
-Meta data about your forests.  Since you can't directly name your forests, you
-can instead put identifying data in the root's child metadata records.
+Meta data about your forests.  Forests can be given names with
+NewNamedForest and found again with GetForestByName (see names.go).
 */
 
 import (
@@ -43,6 +43,7 @@ import (
 	"github.com/AVickory/levTree/keyChain"
 	"bytes"
 	"encoding/gob"
+	"encoding/json"
 )
 
 type Keyor interface {
@@ -58,12 +59,45 @@ type locateable interface {
 	GetSiblingBucket() keyChain.Loc
 	MakeChildBranch() (keyChain.KeyChain, error)
 	MakeChildTree() (keyChain.KeyChain, error)
+	MakeSiblingBranch() (keyChain.KeyChain, error)
+	MakeSiblingTree() (keyChain.KeyChain, error)
+	ParentIsTree() bool
+	GetTreeAncestors() []keyChain.Loc
+}
+
+//reports whether l is known to be a tree.  Only Nodes and KeyChains say, so
+//anything else is treated as a branch.
+func isTree(l locateable) bool {
+	switch v := l.(type) {
+	case Node:
+		return v.IsTree
+	case keyChain.KeyChain:
+		return v.IsTree
+	}
+
+	return false
 }
 
 //a Record describes a location in the db.
 type Node struct {
 	keyChain.KeyChain
 	Data []byte
+
+	//the number of times the Node has been updated.  It goes up by one every
+	//time an update to the Node is committed, so it can be used to tell
+	//whether the Node has changed since it was read.
+	Version uint64
+
+	//whether the Node is one of its parent's ordered children (see
+	//ordered.go), so its id is made from its position.
+	Ordered bool
+}
+
+//A Subtree is a Node with its children attached, in key order, each of which
+//is a Subtree with its own children attached.
+type Subtree struct {
+	Node
+	Children []*Subtree
 }
 
 //Creates a Node whose children will be in the same namespace as this branch.
@@ -106,6 +140,46 @@ func makeTree(parent locateable, data []byte) (Node, error) {
 	return newTree, nil
 }
 
+//Creates a branch with the same parent as n, without needing to look up the
+//parent.
+func makeSiblingBranch(n locateable, data []byte) (Node, error) {
+	var newBranch Node
+
+	kc, err := n.MakeSiblingBranch()
+
+	if err != nil {
+		fmt.Println("error getting new location", err)
+		return newBranch, err
+	}
+
+	newBranch = Node{
+		KeyChain: kc,
+		Data: data,
+	}
+
+	return newBranch, nil
+}
+
+//Creates a tree with the same parent as n, without needing to look up the
+//parent.
+func makeSiblingTree(n locateable, data []byte) (Node, error) {
+	var newTree Node
+
+	kc, err := n.MakeSiblingTree()
+
+	if err != nil {
+		fmt.Println("error getting new location", err)
+		return newTree, err
+	}
+
+	newTree = Node{
+		KeyChain: kc,
+		Data: data,
+	}
+
+	return newTree, nil
+}
+
 //branch nodes put their children in the same bucket that they are in while
 //trees put their children in a different bucket (currently tree children
 //have their namespace set to the id of the tree Node, but this may change
@@ -134,10 +208,40 @@ func makeForest(data []byte) (Node, error) {
 // 	return n.Height == 0 && n.IsTree()
 // }
 
+//how a Node is stored.  KeyChains and Locs marshal themselves as text, which
+//gob would use in place of their fields, so Nodes are stored through these
+//instead.  They have the same fields as a Node, so nodes stored before there was
+//a text format read back the same.
+type storedNode struct {
+	KeyChain storedKeyChain
+	Data []byte
+	Version uint64
+	Ordered bool
+}
+
+type storedKeyChain struct {
+	IsTree bool
+	NameSpace []keyChain.Id
+	GrandParentId keyChain.Id
+	ParentId keyChain.Id
+	Id keyChain.Id
+}
+
 func (n *Node) serialize() ([]byte, error) {
 	var gobble bytes.Buffer
 	enc := gob.NewEncoder(&gobble)
-	err := enc.Encode(*n)
+	err := enc.Encode(storedNode{
+		KeyChain: storedKeyChain{
+			IsTree: n.IsTree,
+			NameSpace: n.NameSpace,
+			GrandParentId: n.GrandParentId,
+			ParentId: n.ParentId,
+			Id: n.Id,
+		},
+		Data: n.Data,
+		Version: n.Version,
+		Ordered: n.Ordered,
+	})
 
 	if err != nil {
 		fmt.Println("SERIALIZATION ERROR: ", err)
@@ -153,12 +257,84 @@ func (n *Node) deserialize(value []byte) (error) {
 	gobble := bytes.NewBuffer(value)
 	// fmt.Println("gobble: ", gobble)
 	dec := gob.NewDecoder(gobble)
-	err := dec.Decode(n)
+	var stored storedNode
+	err := dec.Decode(&stored)
 
 	if err != nil {
 		fmt.Println("DESERIALIZATION ERROR: ", err)
 		return err
 	}
 
+	*n = Node{
+		KeyChain: keyChain.KeyChain{
+			IsTree: stored.KeyChain.IsTree,
+			NameSpace: stored.KeyChain.NameSpace,
+			GrandParentId: stored.KeyChain.GrandParentId,
+			ParentId: stored.KeyChain.ParentId,
+			Id: stored.KeyChain.Id,
+		},
+		Data: stored.Data,
+		Version: stored.Version,
+		Ordered: stored.Ordered,
+	}
+
+	return nil
+}
+
+//how Nodes are written as JSON.  Nodes would otherwise be written as just the
+//text of the KeyChain they embed.
+type nodeJSON struct {
+	KeyChain keyChain.KeyChain
+	Data []byte
+	Version uint64
+	Ordered bool
+}
+
+type subtreeJSON struct {
+	nodeJSON
+	Children []*Subtree
+}
+
+//Nodes and Subtrees would otherwise print as just their KeyChain's text, which
+//they get from embedding it, and leave out the rest of their fields.
+func (n Node) String() string {
+	return fmt.Sprintf("{%v %v %v %v}", n.KeyChain, n.Data, n.Version, n.Ordered)
+}
+
+func (s Subtree) String() string {
+	return fmt.Sprintf("{%v %v}", s.Node, s.Children)
+}
+
+func (n Node) MarshalJSON() ([]byte, error) {
+	return json.Marshal(nodeJSON{n.KeyChain, n.Data, n.Version, n.Ordered})
+}
+
+func (n *Node) UnmarshalJSON(b []byte) error {
+	var j nodeJSON
+	err := json.Unmarshal(b, &j)
+
+	if err != nil {
+		return err
+	}
+
+	*n = Node{j.KeyChain, j.Data, j.Version, j.Ordered}
+
+	return nil
+}
+
+func (s Subtree) MarshalJSON() ([]byte, error) {
+	return json.Marshal(subtreeJSON{nodeJSON{s.KeyChain, s.Data, s.Version, s.Ordered}, s.Children})
+}
+
+func (s *Subtree) UnmarshalJSON(b []byte) error {
+	var j subtreeJSON
+	err := json.Unmarshal(b, &j)
+
+	if err != nil {
+		return err
+	}
+
+	*s = Subtree{Node{j.KeyChain, j.Data, j.Version, j.Ordered}, j.Children}
+
 	return nil
 }
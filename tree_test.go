@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"testing"
 	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"github.com/AVickory/levTree/keyChain"
 )
 
 func testParentChildRel(t *testing.T, parent Node, child Node) {
@@ -19,18 +22,11 @@ func testNode(t *testing.T, parent Node, n Node, data []byte) {
 	if d := n.Data; !bytes.Equal(d, data) {
 		t.Error("NODE HAS WRONG DATA: ", d)
 	}
-	if n.IsTree {
-		if len(n.Key()) != len(parent.GetChildBucket().Key())+24 {
-			t.Error("NODE KEY SHOULD BE A GUUID: ", len(n.Key()))
-		}
-	} else if n.ParentIsTree() {
-		if len(n.Key()) != len(parent.GetChildBucket().Key())+48 {
-			t.Error("NODE KEY SHOULD BE A GUUID: ", len(n.Key()))
-		}
-	} else {
-		if len(n.Key()) != len(parent.GetChildBucket().Key())+24 {
-			t.Error("NODE KEY SHOULD BE A GUUID: ", len(n.Key()))
-		}
+	if len(n.Id.Identifier) != 16 {
+		t.Error("NODE KEY SHOULD BE A GUUID: ", len(n.Id.Identifier))
+	}
+	if !bytes.Equal(n.Key(), append(parent.GetChildBucket().Key(), n.Id.Key()...)) {
+		t.Error("NODE KEY SHOULD BE ITS PARENT'S CHILD BUCKET AND ITS ID: ", n.Key())
 	}
 
 	testParentChildRel(t, parent, n)
@@ -288,3 +284,72 @@ func TestSerializeDeSerialize(t *testing.T) {
 	serializeDeserializeTest(t, n11)
 	serializeDeserializeTest(t, n12)
 }
+
+//how Nodes were stored before KeyChains could be written as text.
+type oldKeyChain struct {
+	IsTree bool
+	NameSpace []keyChain.Id
+	GrandParentId keyChain.Id
+	ParentId keyChain.Id
+	Id keyChain.Id
+}
+
+type oldNode struct {
+	KeyChain oldKeyChain
+	Data []byte
+	Version uint64
+}
+
+func TestSerializeText(t *testing.T) {
+	forest, err := makeForest([]byte{0})
+	if err != nil {
+		t.Error("ERROR MAKING FOREST: ", err)
+	}
+	n1, err := makeBranch(forest, []byte{4})
+	if err != nil {
+		t.Error("GUUID ERROR", err)
+	}
+	n1.Version = 3
+
+	//nodes already on a db still read back.
+	var gobble bytes.Buffer
+	err = gob.NewEncoder(&gobble).Encode(oldNode{
+		oldKeyChain{n1.IsTree, n1.NameSpace, n1.GrandParentId, n1.ParentId, n1.Id},
+		n1.Data,
+		n1.Version,
+	})
+	if err != nil {
+		t.Error("ERROR ENCODING OLD NODE", err)
+	}
+	var old Node
+	err = old.deserialize(gobble.Bytes())
+	if err != nil || !testNodeEquality(n1, old) || old.Version != n1.Version {
+		t.Error("OLD NODE DID NOT DESERIALIZE", err)
+	}
+
+	//nodes and subtrees keep their data in JSON.
+	s := Subtree{Node: forest, Children: []*Subtree{{Node: n1}}}
+	j, err := json.Marshal(s)
+	if err != nil {
+		t.Error("JSON ERROR", err)
+	}
+	var newS Subtree
+	err = json.Unmarshal(j, &newS)
+	if err != nil {
+		t.Error("JSON ERROR", err)
+	}
+	if !testNodeEquality(forest, newS.Node) || len(newS.Children) != 1 ||
+		!testNodeEquality(n1, newS.Children[0].Node) || newS.Children[0].Version != 3 {
+		t.Error("SUBTREE DID NOT COME BACK FROM JSON: ", string(j))
+	}
+
+	//printing a node still shows its data, not just its keychain.
+	printed := fmt.Sprint(n1)
+	if printed != "{" + n1.KeyChain.String() + " [4] 3 false}" {
+		t.Error("NODE PRINTED WRONG: ", printed)
+	}
+	printed = fmt.Sprint(s)
+	if printed != "{" + fmt.Sprint(forest) + " [{" + fmt.Sprint(n1) + " []}]}" {
+		t.Error("SUBTREE PRINTED WRONG: ", printed)
+	}
+}
@@ -0,0 +1,347 @@
+package levTree
+
+/*
+The tx module is the update interface.  An update locks the nodes it's given,
+loads their most up to date copies, lets you change them and then puts the
+changes in the funnel.  Update does all of that around a callback, so the locks
+are always released no matter how the callback returns (or panics).
+OpenUpdate and CloseUpdate are the same thing split in two for code that can't
+be written as a callback, but it's up to you to make sure CloseUpdate gets
+called.
+*/
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Returned when a Node that isn't part of an update is passed to it.
+var ErrNotInUpdate = errors.New("levTree: node is not part of this update")
+
+// Returned when an update is committed with a Node whose Version is not the
+// stored Version, meaning the Node has been updated since it was read.
+var ErrConflict = errors.New("levTree: node has been updated since it was read")
+
+// A Tx is an update in progress.  It holds the locks on its nodes until it's
+// committed or discarded.
+type Tx struct {
+	db *DB
+
+	//the keys of the locked nodes, in the order they were passed in.
+	keys []string
+
+	//the current copy of each locked node by key.
+	nodes map[string]Node
+
+	//the Version each node had when it was locked.  Since the nodes stay
+	//locked these are the stored versions until the update commits.
+	versions map[string]uint64
+
+	//keys of the nodes that have been put or deleted, in the order they were
+	//first put or deleted.
+	updated []string
+
+	//keys of the nodes that have been deleted.  A put after a delete undoes
+	//it.
+	deleted map[string]bool
+
+	released bool
+}
+
+//the updates opened by OpenUpdate that haven't been closed yet, by node key.
+type openUpdates struct {
+	mutex sync.Mutex
+	txs map[string]*Tx
+}
+
+// Locks the nodes at locs, loads them and passes them to fn as a Tx.  If fn
+// returns nil the nodes that were put on the Tx go into the funnel, otherwise
+// they're thrown away and fn's error is returned.  Either way the nodes are
+// unlocked by the time Update returns.
+func (db *DB) Update(fn func(tx *Tx) error, locs ...locateable) error {
+	tx, err := db.begin(locs...)
+
+	if err != nil {
+		fmt.Println("error beginning update: ", err)
+		return err
+	}
+
+	defer tx.release()
+
+	err = fn(tx)
+
+	if err != nil {
+		return err
+	}
+
+	return tx.commit()
+}
+
+//locks and loads the nodes at locs.  Nothing is left locked if it fails.
+func (db *DB) begin(locs ...locateable) (*Tx, error) {
+	tx := &Tx{
+		db: db,
+		keys: make([]string, len(locs)),
+		nodes: make(map[string]Node, len(locs)),
+		versions: make(map[string]uint64, len(locs)),
+		deleted: make(map[string]bool),
+	}
+
+	for i, l := range locs {
+		tx.keys[i] = l.GetLoc().KeyString()
+	}
+
+	db.locks.lock(tx.keys...)
+
+	for _, l := range locs {
+		n, err := db.getNodeUpdateable(l.GetLoc())
+
+		if err != nil {
+			fmt.Println("error getting updateable Node", err)
+			tx.release()
+			return nil, err
+		}
+
+		tx.nodes[n.KeyString()] = n
+		tx.versions[n.KeyString()] = n.Version
+	}
+
+	return tx, nil
+}
+
+// Returns the update's nodes in the order their locations were passed in.
+// DO NOT MODIFY LOCATIONS.  Put changes back with Put for them to be saved.
+func (tx *Tx) Nodes() []Node {
+	nodes := make([]Node, len(tx.keys))
+
+	for i, k := range tx.keys {
+		nodes[i] = tx.nodes[k]
+	}
+
+	return nodes
+}
+
+// Gets the update's copy of the node at l, which must be one of the update's
+// nodes.
+func (tx *Tx) Get(l locateable) (Node, error) {
+	n, isInUpdate := tx.nodes[l.GetLoc().KeyString()]
+
+	if !isInUpdate {
+		return n, ErrNotInUpdate
+	}
+
+	return n, nil
+}
+
+// Saves n as part of the update.  n must be one of the update's nodes, and its
+// Version must be left as it was read or the update will fail with
+// ErrConflict.
+func (tx *Tx) Put(n Node) error {
+	key := n.KeyString()
+
+	_, isInUpdate := tx.nodes[key]
+
+	if !isInUpdate {
+		fmt.Println("error putting node: ", ErrNotInUpdate)
+		return ErrNotInUpdate
+	}
+
+	if !tx.isUpdated(key) {
+		tx.updated = append(tx.updated, key)
+	}
+
+	tx.nodes[key] = n
+	delete(tx.deleted, key)
+
+	return nil
+}
+
+// Deletes the node at l as part of the update.  l must be one of the update's
+// nodes.  Only the node itself is deleted, its children are left where they
+// are.
+func (tx *Tx) Delete(l locateable) error {
+	key := l.GetLoc().KeyString()
+
+	_, isInUpdate := tx.nodes[key]
+
+	if !isInUpdate {
+		fmt.Println("error deleting node: ", ErrNotInUpdate)
+		return ErrNotInUpdate
+	}
+
+	if !tx.isUpdated(key) {
+		tx.updated = append(tx.updated, key)
+	}
+
+	tx.deleted[key] = true
+
+	return nil
+}
+
+func (tx *Tx) isUpdated(key string) bool {
+	for _, k := range tx.updated {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+//checks the updated nodes' versions and puts them in the funnel with their
+//versions bumped, along with tombstones for the deleted nodes.  If any of
+//them conflict nothing is put.  Doesn't release the locks.
+func (tx *Tx) commit() error {
+	if len(tx.updated) == 0 {
+		return nil
+	}
+
+	updatedNodes := make([]Node, 0, len(tx.updated))
+	deletedNodes := make([]Node, 0, len(tx.deleted))
+
+	for _, k := range tx.updated {
+		n := tx.nodes[k]
+
+		if tx.deleted[k] {
+			deletedNodes = append(deletedNodes, n)
+			continue
+		}
+
+		if n.Version != tx.versions[k] {
+			fmt.Println("error committing update: ", ErrConflict,
+				"\n\tnode Key: ", n.Key(),
+				"\n\texpected version: ", tx.versions[k],
+				"\n\tfound version: ", n.Version)
+			return ErrConflict
+		}
+
+		n.Version++
+		updatedNodes = append(updatedNodes, n)
+	}
+
+	tx.db.funnel.mutex.Lock()
+	defer tx.db.funnel.mutex.Unlock()
+
+	err := tx.db.bulkWrite(updatedNodes, deletedNodes)
+
+	if err != nil {
+		fmt.Println("error committing update: ", err)
+		return err
+	}
+
+	return nil
+}
+
+//unlocks the update's nodes.  Safe to call more than once.
+func (tx *Tx) release() {
+	if !tx.released {
+		tx.released = true
+		tx.db.locks.unlock(tx.keys...)
+	}
+}
+
+// Replaces the Data of the node at l with newData, but only if the node's
+// Version is still expectedVersion.  Otherwise it fails with ErrConflict and
+// nothing changes.  This allows a Node to be read, changed and written back
+// without holding it locked in between.
+func (db *DB) CompareAndSwap(l locateable, expectedVersion uint64, newData []byte) error {
+	return db.Update(func(tx *Tx) error {
+		n, err := tx.Get(l)
+
+		if err != nil {
+			return err
+		}
+
+		if n.Version != expectedVersion {
+			return ErrConflict
+		}
+
+		n.Data = newData
+
+		return tx.Put(n)
+	}, l)
+}
+
+// Returns the most up-to-date version of the node at the locations ls indicates.
+// These nodes can be updated, but must be passed into Close Update for thos
+// updates to take place (or for any updates to these nodes to ever take place
+// again).  Prefer Update, which can't leave nodes locked.  It is intended for
+// updates only.  If you want to do insertions use the new functions and if you
+// only need to read, then use the get functions.
+// note that changing the child and parent meta data on one node does not
+// automatically change the corresponding data on the parent or child node.
+// DO NOT MODIFY LOCATIONS.  if you do, you may end up with duplicates on the
+// db, and CloseUpdate won't be able to find the update they belong to.
+// Only the nodes being updated are locked, so updates to other nodes can go
+// ahead at the same time.  If it returns an error nothing is left locked.
+func (db *DB) OpenUpdate(kcs ...locateable) ([]Node, error) {
+	tx, err := db.begin(kcs...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	db.openUpdates.mutex.Lock()
+	for _, k := range tx.keys {
+		db.openUpdates.txs[k] = tx
+	}
+	db.openUpdates.mutex.Unlock()
+
+	return tx.Nodes(), nil
+}
+
+// Puts the updated nodes in the funnel and releases the update(s) they were
+// opened by.  Every node passed in must have come from OpenUpdate, but they
+// don't all have to be passed back.  If any of them has a Version that isn't
+// the stored one (because it wasn't the copy OpenUpdate returned) ErrConflict
+// is returned and none of that update's nodes are saved.  If the db keeps a
+// write ahead log the nodes are on it by the time this returns, and if they
+// can't be logged the update is dropped and the error returned.  The nodes are
+// unlocked either way.
+func (db *DB) CloseUpdate(updatedNodes ...Node) error {
+	txs := make([]*Tx, 0, 1)
+	txNodes := make(map[*Tx][]Node)
+
+	db.openUpdates.mutex.Lock()
+	for _, n := range updatedNodes {
+		tx, isOpen := db.openUpdates.txs[n.KeyString()]
+
+		if !isOpen {
+			db.openUpdates.mutex.Unlock()
+			fmt.Println("error closing update: ", ErrNotInUpdate)
+			return ErrNotInUpdate
+		}
+
+		if _, seen := txNodes[tx]; !seen {
+			txs = append(txs, tx)
+		}
+
+		txNodes[tx] = append(txNodes[tx], n)
+	}
+
+	for _, tx := range txs {
+		for _, k := range tx.keys {
+			delete(db.openUpdates.txs, k)
+		}
+	}
+	db.openUpdates.mutex.Unlock()
+
+	var err error
+
+	for _, tx := range txs {
+		for _, n := range txNodes[tx] {
+			//can't fail, the node was found in this update.
+			tx.Put(n)
+		}
+
+		commitErr := tx.commit()
+		tx.release()
+
+		if commitErr != nil {
+			fmt.Println("error closing update: ", commitErr)
+			err = commitErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,263 @@
+package levTree
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestUpdateCommits (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	b0 := branchTest(t, db, f0, []byte{1})
+
+	err = db.Update(func(tx *Tx) error {
+		nodes := tx.Nodes()
+
+		if len(nodes) != 2 {
+			t.Error("update should have loaded 2 nodes, but loaded: ", len(nodes))
+		}
+
+		for _, n := range nodes {
+			n.Data = []byte{n.Data[0] + 10}
+			err := tx.Put(n)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}, f0, b0)
+
+	if err != nil {
+		t.Error("error updating: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{10}, f0)
+
+	_ = nodeTest(t, db, []byte{11}, b0)
+}
+
+func TestUpdateDiscardsOnError (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	callbackErr := errors.New("callback failed")
+
+	err = db.Update(func(tx *Tx) error {
+		n, err := tx.Get(f0)
+		if err != nil {
+			return err
+		}
+		n.Data = []byte{1}
+		err = tx.Put(n)
+		if err != nil {
+			return err
+		}
+		return callbackErr
+	}, f0)
+
+	if err != callbackErr {
+		t.Error("update should have returned the callback's error, but returned: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{0}, f0)
+
+	if len(db.locks.locks) != 0 {
+		t.Error("update left nodes locked after an error")
+	}
+}
+
+func TestUpdateReleasesOnPanic (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	func() {
+		defer func() {
+			recover()
+		}()
+
+		db.Update(func(tx *Tx) error {
+			panic("callback panicked")
+		}, f0)
+	}()
+
+	if len(db.locks.locks) != 0 {
+		t.Error("update left nodes locked after a panic")
+	}
+}
+
+func TestTxPutRejectsOtherNodes (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	f1 := forestTest(t, db, []byte{1})
+
+	err = db.Update(func(tx *Tx) error {
+		return tx.Put(f1)
+	}, f0)
+
+	if err != ErrNotInUpdate {
+		t.Error("putting a node that wasn't locked should have failed, but returned: ", err)
+	}
+}
+
+func TestOpenUpdateReleasesOnError (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	missing, err := makeForest([]byte{1})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	_, err = db.OpenUpdate(f0, missing)
+
+	if err == nil {
+		t.Error("opening an update on a node that isn't on the db should fail")
+	}
+
+	if len(db.locks.locks) != 0 {
+		t.Error("failed open update left nodes locked")
+	}
+
+	nodes, err := db.OpenUpdate(f0)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	nodes[0].Data = []byte{2}
+
+	err = db.CloseUpdate(nodes...)
+
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
+
+	err = db.CloseUpdate(nodes...)
+
+	if err != ErrNotInUpdate {
+		t.Error("closing an update twice should fail, but returned: ", err)
+	}
+
+	n := nodeTest(t, db, []byte{2}, f0)
+
+	if !bytes.Equal(n.Data, []byte{2}) {
+		t.Error("close update did not save the node")
+	}
+}
+
+func TestVersions (t *testing.T) {
+	db, err := initForSynchronousTests(t)
+
+	if err != nil {
+		t.Error("error initializing db: ", err)
+	}
+
+	defer db.Close()
+
+	f0 := forestTest(t, db, []byte{0})
+
+	if f0.Version != 0 {
+		t.Error("new nodes should start at version 0, not: ", f0.Version)
+	}
+
+	err = db.CompareAndSwap(f0, 0, []byte{1})
+
+	if err != nil {
+		t.Error("error swapping data: ", err)
+	}
+
+	n := nodeTest(t, db, []byte{1}, f0)
+
+	if n.Version != 1 {
+		t.Error("update should have bumped the version to 1, but it's: ", n.Version)
+	}
+
+	err = db.CompareAndSwap(f0, 0, []byte{2})
+
+	if err != ErrConflict {
+		t.Error("swapping with a stale version should conflict, but returned: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{1}, f0)
+
+	nodes, err := db.OpenUpdate(f0)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	//f0 is the copy that was read before the swap.
+	f0.Data = []byte{3}
+
+	err = db.CloseUpdate(f0)
+
+	if err != ErrConflict {
+		t.Error("closing an update with a stale node should conflict, but returned: ", err)
+	}
+
+	_ = nodeTest(t, db, []byte{1}, f0)
+
+	if len(db.locks.locks) != 0 {
+		t.Error("conflicting close update left nodes locked")
+	}
+
+	nodes, err = db.OpenUpdate(f0)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	nodes[0].Data = []byte{4}
+
+	err = db.CloseUpdate(nodes...)
+
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
+
+	n = nodeTest(t, db, []byte{4}, f0)
+
+	if n.Version != 2 {
+		t.Error("update should have bumped the version to 2, but it's: ", n.Version)
+	}
+}
@@ -0,0 +1,227 @@
+package levTree
+
+/*
+The wal module is an optional write ahead log for the funnel.  Updates that have
+been closed only live in the funnel's memory until the next time it's cleared,
+so if the process dies in between they're gone.  With the log turned on every
+node that goes into the funnel is first appended to a file next to the leveldb
+directory (and synced), and the file is truncated each time the funnel is
+successfully written to the db.  When the db is opened again anything left in
+the log is put back into the funnel and written.
+
+Everything that goes into the funnel together is logged as a single record: the
+length of the record as 4 big endian bytes followed by its entries.  Each entry
+is a byte saying whether it's a put or a delete, the length of the serialized
+Node as 4 big endian bytes and then the Node itself.  A record that was cut
+short by a crash is ignored when the log is replayed, since it can't have been
+acknowledged, so a group of puts and deletes is replayed all or nothing.
+*/
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+//suffix appended to the db's path to get the path of its log.
+const walSuffix string = ".wal"
+
+type wal struct {
+	mutex sync.Mutex
+	file *os.File
+}
+
+//a single put or delete in the log.  For deletes, only the node's location
+//matters.
+type walEntry struct {
+	node Node
+	deleted bool
+}
+
+const (
+	walPut byte = iota
+	walDelete
+)
+
+//opens the log at path, creating it if it doesn't exist yet.
+func openWal(path string) (*wal, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+
+	if err != nil {
+		fmt.Println("error opening write ahead log: ", err)
+		return nil, err
+	}
+
+	return &wal{file: file}, nil
+}
+
+//appends entries to the log as a single record and doesn't return until it's
+//synced to disk.
+func (w *wal) append(entries ...walEntry) error {
+	record := make([]byte, 4)
+
+	for _, e := range entries {
+		nSerial, err := e.node.serialize()
+
+		if err != nil {
+			fmt.Println("error serializing node for write ahead log: ", err)
+			return err
+		}
+
+		op := walPut
+		if e.deleted {
+			op = walDelete
+		}
+
+		record = append(record, op)
+		record = appendLength(record, len(nSerial))
+		record = append(record, nSerial...)
+	}
+
+	binary.BigEndian.PutUint32(record[:4], uint32(len(record) - 4))
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err := w.file.Seek(0, io.SeekEnd)
+
+	if err != nil {
+		fmt.Println("error seeking to end of write ahead log: ", err)
+		return err
+	}
+
+	_, err = w.file.Write(record)
+
+	if err != nil {
+		fmt.Println("error writing to write ahead log: ", err)
+		return err
+	}
+
+	err = w.file.Sync()
+
+	if err != nil {
+		fmt.Println("error syncing write ahead log: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func appendLength(b []byte, length int) []byte {
+	l := make([]byte, 4)
+	binary.BigEndian.PutUint32(l, uint32(length))
+	return append(b, l...)
+}
+
+//reads the entries of every complete record in the log, oldest first.
+func (w *wal) replay() ([]walEntry, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	_, err := w.file.Seek(0, io.SeekStart)
+
+	if err != nil {
+		fmt.Println("error seeking to start of write ahead log: ", err)
+		return nil, err
+	}
+
+	reader := bufio.NewReader(w.file)
+	entries := make([]walEntry, 0)
+	length := make([]byte, 4)
+
+	for {
+		_, err = io.ReadFull(reader, length)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			fmt.Println("error reading write ahead log: ", err)
+			return entries, err
+		}
+
+		record := make([]byte, binary.BigEndian.Uint32(length))
+		_, err = io.ReadFull(reader, record)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			fmt.Println("error reading write ahead log: ", err)
+			return entries, err
+		}
+
+		recordEntries, err := parseWalRecord(record)
+
+		if err != nil {
+			fmt.Println("error parsing write ahead log record: ", err)
+			return entries, err
+		}
+
+		entries = append(entries, recordEntries...)
+	}
+
+	return entries, nil
+}
+
+//splits a complete record back into its entries.
+func parseWalRecord(record []byte) ([]walEntry, error) {
+	entries := make([]walEntry, 0, 1)
+
+	for len(record) != 0 {
+		if len(record) < 5 {
+			return entries, io.ErrUnexpectedEOF
+		}
+
+		op := record[0]
+		length := binary.BigEndian.Uint32(record[1:5])
+		record = record[5:]
+
+		if uint32(len(record)) < length {
+			return entries, io.ErrUnexpectedEOF
+		}
+
+		var n Node
+		err := n.deserialize(record[:length])
+
+		if err != nil {
+			fmt.Println("error deserializing write ahead log entry: ", err)
+			return entries, err
+		}
+
+		entries = append(entries, walEntry{node: n, deleted: op == walDelete})
+		record = record[length:]
+	}
+
+	return entries, nil
+}
+
+//empties the log.  Should only be called once everything in it is on the db.
+func (w *wal) truncate() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	err := w.file.Truncate(0)
+
+	if err != nil {
+		fmt.Println("error truncating write ahead log: ", err)
+		return err
+	}
+
+	err = w.file.Sync()
+
+	if err != nil {
+		fmt.Println("error syncing write ahead log: ", err)
+		return err
+	}
+
+	return nil
+}
+
+func (w *wal) close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.file.Close()
+}
@@ -0,0 +1,282 @@
+package levTree
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+//closes the db's handles without flushing the funnel, the same as if the
+//process had died.
+func crash(db *DB) {
+	db.closeOnce.Do(func() {
+		close(db.stop)
+	})
+
+	<-db.stopped
+
+	db.wal.close()
+	db.ldb.Close()
+}
+
+func TestWalReplay (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	err = os.RemoveAll(path + walSuffix)
+
+	if err != nil {
+		t.Error("error clearing write ahead log: ", err)
+	}
+
+	opts := Options{WriteInterval: time.Hour, WriteAheadLog: true}
+
+	db, err := Open(path, opts)
+
+	if err != nil {
+		t.Error("error opening db: ", err)
+	}
+
+	fKc, err := db.NewForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	nodes, err := db.OpenUpdate(fKc)
+
+	if err != nil {
+		t.Error("error opening update: ", err)
+	}
+
+	nodes[0].Data = []byte{1}
+
+	err = db.CloseUpdate(nodes...)
+
+	if err != nil {
+		t.Error("error closing update: ", err)
+	}
+
+	bKc, err := db.NewBranch(fKc, []byte{2})
+
+	if err != nil {
+		t.Error("error making branch: ", err)
+	}
+
+	err = db.Delete(bKc)
+
+	if err != nil {
+		t.Error("error deleting branch: ", err)
+	}
+
+	crash(db)
+
+	db, err = Open(path, opts)
+
+	if err != nil {
+		t.Error("error reopening db: ", err)
+	}
+
+	defer db.Close()
+
+	f, err := db.getNode(fKc.GetLoc())
+
+	if err != nil {
+		t.Error("error getting forest: ", err)
+	}
+
+	if !bytes.Equal(f.Data, []byte{1}) {
+		t.Error("update was not replayed from the write ahead log: ", f.Data)
+	}
+
+	_, err = db.getNode(bKc.GetLoc())
+
+	if err != ErrNotFound {
+		t.Error("delete was not replayed from the write ahead log: ", err)
+	}
+
+	info, err := os.Stat(path + walSuffix)
+
+	if err != nil {
+		t.Error("error checking write ahead log: ", err)
+	} else if info.Size() != 0 {
+		t.Error("write ahead log should have been truncated after replay, but has size: ", info.Size())
+	}
+}
+
+func TestWalIgnoresTornEntry (t *testing.T) {
+	path := "./data/" + t.Name() + walSuffix
+
+	err := os.RemoveAll(path)
+
+	if err != nil {
+		t.Error("error clearing write ahead log: ", err)
+	}
+
+	err = os.MkdirAll("./data", 0755)
+
+	if err != nil {
+		t.Error("error making data directory: ", err)
+	}
+
+	w, err := openWal(path)
+
+	if err != nil {
+		t.Error("error opening write ahead log: ", err)
+	}
+
+	defer w.close()
+
+	n, err := makeForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	err = w.append(walEntry{node: n})
+
+	if err != nil {
+		t.Error("error appending to write ahead log: ", err)
+	}
+
+	//the start of a record whose body never made it to disk.
+	_, err = w.file.Write([]byte{0, 0, 1, 0, walPut})
+
+	if err != nil {
+		t.Error("error writing torn entry: ", err)
+	}
+
+	entries, err := w.replay()
+
+	if err != nil {
+		t.Error("error replaying write ahead log: ", err)
+	}
+
+	if len(entries) != 1 || !entries[0].node.Equal(n.KeyChain) || entries[0].deleted {
+		t.Error("replay should have returned only the complete entry, but returned: ", entries)
+	}
+}
+
+func TestWalTornRecordThenWrite (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	err = os.RemoveAll(path + walSuffix)
+
+	if err != nil {
+		t.Error("error clearing write ahead log: ", err)
+	}
+
+	opts := Options{WriteInterval: time.Hour, WriteAheadLog: true}
+
+	db, err := Open(path, opts)
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	fKc, err := db.NewForest([]byte{0})
+
+	if err != nil {
+		t.Error("error making forest: ", err)
+	}
+
+	//a crash part way through the first record after a flush.
+	_, err = db.wal.file.Write([]byte{0, 0, 1, 0, walPut})
+
+	if err != nil {
+		t.Error("error writing torn record: ", err)
+	}
+
+	crash(db)
+
+	db, err = Open(path, opts)
+
+	if err != nil {
+		t.Fatal("error reopening db after torn record: ", err)
+	}
+
+	err = db.CompareAndSwap(fKc, 0, []byte{1})
+
+	if err != nil {
+		t.Error("error updating forest: ", err)
+	}
+
+	crash(db)
+
+	db, err = Open(path, opts)
+
+	if err != nil {
+		t.Fatal("error reopening db after update: ", err)
+	}
+
+	defer db.Close()
+
+	f, err := db.Get(fKc)
+
+	if err != nil {
+		t.Error("error getting forest: ", err)
+	}
+
+	if !bytes.Equal(f.Data, []byte{1}) {
+		t.Error("update logged after a torn record was lost: ", f.Data)
+	}
+}
+
+func TestWalSyncsFunnel (t *testing.T) {
+	path := "./data/" + t.Name()
+
+	err := clearDb(path)
+
+	if err != nil {
+		t.Error("error clearing db: ", err)
+	}
+
+	err = os.RemoveAll(path + walSuffix)
+
+	if err != nil {
+		t.Error("error clearing write ahead log: ", err)
+	}
+
+	db, err := Open(path, Options{WriteInterval: time.Hour, WriteAheadLog: true})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	//the log is truncated after every write, so the write has to be synced.
+	wo := db.funnelWriteOptions()
+
+	if wo == nil || !wo.Sync {
+		t.Error("funnel should be written with sync when there's a write ahead log")
+	}
+
+	err = db.Close()
+
+	if err != nil {
+		t.Error("error closing db: ", err)
+	}
+
+	db, err = Open(path, Options{WriteInterval: time.Hour})
+
+	if err != nil {
+		t.Fatal("error opening db: ", err)
+	}
+
+	defer db.Close()
+
+	if db.funnelWriteOptions().GetSync() {
+		t.Error("funnel should not be synced without a write ahead log")
+	}
+}